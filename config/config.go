@@ -4,19 +4,31 @@ import (
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
 type Configs struct {
-	App   *AppConfig `json:"app" mapstructure:"app"`
-	DB    *DBConf    `json:"db" mapstructure:"db"`
-	Redis *RedisConf `json:"redis" mapstructure:"redis"`
-	Token *Token     `json:"token" mapstructure:"token"`
+	App       *AppConfig     `json:"app" mapstructure:"app"`
+	DB        *DBConf        `json:"db" mapstructure:"db"`
+	Redis     *RedisConf     `json:"redis" mapstructure:"redis"`
+	Token     *Token         `json:"token" mapstructure:"token" default:"{}"`
+	OAuth     *OAuthConf     `json:"oauth" mapstructure:"oauth"`
+	Password  *PasswordConf  `json:"password" mapstructure:"password"`
+	Mail      *MailConf      `json:"mail" mapstructure:"mail"`
+	Throttle  *ThrottleConf  `json:"throttle" mapstructure:"throttle"`
+	MFA       *MFAConf       `json:"mfa" mapstructure:"mfa"`
+	WebAuthn  *WebAuthnConf  `json:"webauthn" mapstructure:"webauthn"`
+	MagicLink *MagicLinkConf `json:"magic_link" mapstructure:"magic_link"`
 }
 
+// AppConfig - the HTTP server. Client IPs are read from X-Forwarded-For and X-Real-IP only for requests coming from
+// one of TrustedProxies, IPs or CIDR ranges of the load balancers in front of the service. Without trusted proxies
+// the address of the connection is used
 type AppConfig struct {
-	TimeOut time.Duration `json:"timeout" mapstructure:"timeout"`
-	Port    int           `json:"port" mapstructure:"port"`
+	TimeOut        time.Duration `json:"timeout" mapstructure:"timeout"`
+	Port           int           `json:"port" mapstructure:"port"`
+	TrustedProxies []string      `json:"trusted_proxies" mapstructure:"trusted_proxies"`
 }
 
 type DBConf struct {
@@ -37,15 +49,222 @@ type RedisConf struct {
 	DB       int    `json:"db" mapstructure:"db"`
 }
 
+// Token - Issuer is put into the iss claim of every token and is also the audience refresh tokens are issued for.
+// Access tokens are issued for Audiences, the services that accept them, and always for Issuer itself.
+// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+// A refresh token presented again within RefreshGrace of its rotation gets the same successor instead of revoking
+// the session, so that concurrent refreshes of one client, e.g. from several tabs or retries, do not sign it out.
 type Token struct {
-	Refresh *TokenConf `json:"refresh" mapstructure:"refresh"`
-	Access  *TokenConf `json:"access" mapstructure:"access"`
+	Issuer       string          `json:"issuer" mapstructure:"issuer"`
+	Audiences    []string        `json:"audiences" mapstructure:"audiences"`
+	Leeway       time.Duration   `json:"leeway" mapstructure:"leeway"`
+	RefreshGrace time.Duration   `json:"refresh_grace" mapstructure:"refresh_grace"`
+	Refresh      *TokenConf      `json:"refresh" mapstructure:"refresh"`
+	Access       *TokenConf      `json:"access" mapstructure:"access"`
+	Signing      *SigningConf    `json:"signing" mapstructure:"signing"`
+	Revocation   *RevocationConf `json:"revocation" mapstructure:"revocation"`
+	StepUp       *StepUpConf     `json:"step_up" mapstructure:"step_up" default:"{}"`
+	// Transport is how clients exchange tokens: "cookie" (default) for browsers,
+	// "bearer" for the Authorization header and response bodies, or "both", which returns tokens in response bodies
+	// only to clients that send X-Token-Transport: bearer or an Authorization: Bearer header
+	Transport string `json:"transport" mapstructure:"transport"`
+}
+
+// RevocationConf configures the denylist of revoked access tokens.
+// CacheTTL is how long a token found not revoked is trusted without asking redis again.
+type RevocationConf struct {
+	CacheTTL time.Duration `json:"cache_ttl" mapstructure:"cache_ttl"`
+}
+
+// StepUpConf configures step-up authentication. Sensitive operations of this service require the user to have signed in
+// or reauthenticated within MaxAge, reauthenticating issues an access token that is valid for TTL.
+// Both have defaults, so the step_up block may be left out.
+type StepUpConf struct {
+	TTL    time.Duration `json:"ttl"     mapstructure:"ttl"     default:"5m"`
+	MaxAge time.Duration `json:"max_age" mapstructure:"max_age" default:"10m"`
 }
 
 type TokenConf struct {
-	TokenSecret string        `json:"token_secret" mapstructure:"token_secret"`
+	TTL    time.Duration `json:"ttl"          mapstructure:"ttl"`
+	Domain string        `json:"domain"       mapstructure:"domain"`
+}
+
+// SigningConf is the key ring tokens are signed and verified with. The key with the latest
+// active_from that is not in the future signs new tokens, every key that is not retired verifies.
+// A superseded key without retire_at is retired once Overlap has passed, which defaults to the longest token TTL.
+// AllowEphemeral is meant for local development only, see SigningKeyConf.
+type SigningConf struct {
+	Overlap        time.Duration     `json:"overlap"         mapstructure:"overlap"`
+	AllowEphemeral bool              `json:"allow_ephemeral" mapstructure:"allow_ephemeral"`
+	Keys           []*SigningKeyConf `json:"keys"            mapstructure:"keys"`
+}
+
+// SigningKeyConf describes a single key of the ring. ActiveFrom and RetireAt are RFC 3339 timestamps.
+// An empty PrivateKeyPath fails start up, unless AllowEphemeral is set and an ephemeral key is generated instead.
+// Tokens signed with an ephemeral key are rejected by other replicas and after a restart.
+type SigningKeyConf struct {
+	ID             string    `json:"id"               mapstructure:"id"`
+	Algorithm      string    `json:"algorithm"        mapstructure:"algorithm"`
+	PrivateKeyPath string    `json:"private_key_path" mapstructure:"private_key_path"`
+	ActiveFrom     time.Time `json:"active_from"      mapstructure:"active_from"`
+	RetireAt       time.Time `json:"retire_at"        mapstructure:"retire_at"`
+}
+
+// OAuthConf lists the clients, e.g. API gateways and other services, allowed to call the
+// token introspection and revocation endpoints. Only clients marked as admin may call the admin endpoints.
+type OAuthConf struct {
+	Clients []*OAuthClient `json:"clients" mapstructure:"clients"`
+}
+
+type OAuthClient struct {
+	ID     string `json:"id"     mapstructure:"id"`
+	Secret string `json:"secret" mapstructure:"secret"`
+	Admin  bool   `json:"admin"  mapstructure:"admin"`
+}
+
+// PasswordConf selects the algorithm new password hashes are made with. Hashes made by another
+// algorithm or with other parameters are still accepted and upgraded on the next successful login.
+type PasswordConf struct {
+	Algorithm string        `json:"algorithm" mapstructure:"algorithm"`
+	Argon2id  *Argon2idConf `json:"argon2id"  mapstructure:"argon2id"`
+	Bcrypt    *BcryptConf   `json:"bcrypt"    mapstructure:"bcrypt"`
+	Pepper    *PepperConf   `json:"pepper"    mapstructure:"pepper"`
+	Policy    *PolicyConf   `json:"policy"    mapstructure:"policy"`
+	Breached  *BreachedConf `json:"breached"  mapstructure:"breached"`
+	Reset     *ResetConf    `json:"reset"     mapstructure:"reset"`
+	// HistorySize is the number of most recent passwords, the current one included,
+	// that cannot be chosen again on a password change or reset. 0 disables the check
+	HistorySize int `json:"history_size" mapstructure:"history_size"`
+}
+
+// Argon2idConf - Memory is in KiB, SaltLength and KeyLength are in bytes.
+type Argon2idConf struct {
+	Memory      uint32 `json:"memory"      mapstructure:"memory"`
+	Iterations  uint32 `json:"iterations"  mapstructure:"iterations"`
+	Parallelism uint8  `json:"parallelism" mapstructure:"parallelism"`
+	SaltLength  uint32 `json:"salt_length" mapstructure:"salt_length"`
+	KeyLength   uint32 `json:"key_length"  mapstructure:"key_length"`
+}
+
+type BcryptConf struct {
+	Cost int `json:"cost" mapstructure:"cost"`
+}
+
+// PepperConf is the server side secret passwords are keyed with before hashing, so leaked hashes cannot be
+// cracked without it. New hashes use the key of version Current, version 0 means no pepper. Older keys
+// must be kept until every hash made with them was upgraded on login.
+type PepperConf struct {
+	Current int              `json:"current" mapstructure:"current"`
+	Keys    []*PepperKeyConf `json:"keys"    mapstructure:"keys"`
+}
+
+// PepperKeyConf - the file at Path holds the raw key, at least 32 bytes long.
+type PepperKeyConf struct {
+	Version int    `json:"version" mapstructure:"version"`
+	Path    string `json:"path"    mapstructure:"path"`
+}
+
+// PolicyConf - the rules new passwords must satisfy, a zero value disables the rule.
+// MaxRepeatedChars limits runs of the same character like "aaaa", MaxSequentialChars runs like "abcd" or "4321".
+// MinEntropy is in bits, estimated from the length and the character classes used.
+// ForbidUserInfo rejects passwords that contain the login, first or last name of the user.
+type PolicyConf struct {
+	MinLength          int     `json:"min_length"           mapstructure:"min_length"`
+	MaxLength          int     `json:"max_length"           mapstructure:"max_length"`
+	RequireUpper       bool    `json:"require_upper"        mapstructure:"require_upper"`
+	RequireLower       bool    `json:"require_lower"        mapstructure:"require_lower"`
+	RequireNumber      bool    `json:"require_number"       mapstructure:"require_number"`
+	RequireSpecial     bool    `json:"require_special"      mapstructure:"require_special"`
+	ForbidUserInfo     bool    `json:"forbid_user_info"     mapstructure:"forbid_user_info"`
+	MaxRepeatedChars   int     `json:"max_repeated_chars"   mapstructure:"max_repeated_chars"`
+	MaxSequentialChars int     `json:"max_sequential_chars" mapstructure:"max_sequential_chars"`
+	MinEntropy         float64 `json:"min_entropy"          mapstructure:"min_entropy"`
+}
+
+// BreachedConf - Path is a local copy of the Have I Been Pwned SHA-1 password list ordered by hash.
+// New passwords seen in at least MinCount breaches are rejected. The check is disabled without a path.
+type BreachedConf struct {
+	Path     string `json:"path"      mapstructure:"path"`
+	MinCount int    `json:"min_count" mapstructure:"min_count"`
+}
+
+// ResetConf - a password reset token is valid for TTL. The emailed link is URL with the token appended,
+// so URL should point to the page of the frontend that lets users pick a new password.
+type ResetConf struct {
+	TTL time.Duration `json:"ttl" mapstructure:"ttl"`
+	URL string        `json:"url" mapstructure:"url"`
+}
+
+// MailConf is the SMTP server emails are sent through. Username may be empty for servers without authentication.
+// QueueSize is the number of emails waiting for delivery after which new ones are dropped.
+type MailConf struct {
+	Host      string `json:"host"       mapstructure:"host"`
+	Port      int    `json:"port"       mapstructure:"port"`
+	Username  string `json:"username"   mapstructure:"username"`
+	Password  string `json:"password"   mapstructure:"password"`
+	From      string `json:"from"       mapstructure:"from"`
+	QueueSize int    `json:"queue_size" mapstructure:"queue_size"`
+}
+
+// ThrottleConf protects sign-in against password guessing. Failed sign-ins are counted per login and
+// per client IP, a count is forgotten after Window without failures. Email limits how often password reset
+// and sign-in links are emailed.
+type ThrottleConf struct {
+	Window time.Duration     `json:"window" mapstructure:"window"`
+	Login  *ThrottleRuleConf `json:"login"  mapstructure:"login"`
+	IP     *ThrottleRuleConf `json:"ip"     mapstructure:"ip"`
+	Email  *SendLimitConf    `json:"email"  mapstructure:"email"`
+}
+
+// ThrottleRuleConf - after FreeAttempts failures every further one blocks sign-in for BaseDelay, doubled on each
+// failure up to MaxDelay. Reaching LockoutThreshold failures blocks sign-in for LockoutDuration, 0 disables the lockout.
+type ThrottleRuleConf struct {
+	FreeAttempts     int           `json:"free_attempts"     mapstructure:"free_attempts"`
+	BaseDelay        time.Duration `json:"base_delay"        mapstructure:"base_delay"`
+	MaxDelay         time.Duration `json:"max_delay"         mapstructure:"max_delay"`
+	LockoutThreshold int           `json:"lockout_threshold" mapstructure:"lockout_threshold"`
+	LockoutDuration  time.Duration `json:"lockout_duration"  mapstructure:"lockout_duration"`
+}
+
+// SendLimitConf - at most PerAddress emails are sent to an address and at most PerIP are asked for from a client IP
+// within Window, 0 disables a limit.
+type SendLimitConf struct {
+	Window     time.Duration `json:"window"      mapstructure:"window"`
+	PerAddress int           `json:"per_address" mapstructure:"per_address"`
+	PerIP      int           `json:"per_ip"      mapstructure:"per_ip"`
+}
+
+// MFAConf configures two-factor sign-in with time-based one-time passwords. Issuer is the name authenticator apps
+// show next to the login. Codes up to Skew time steps of 30 seconds away are accepted to tolerate clock drift.
+// A sign-in waiting for the second factor expires after ChallengeTTL or MaxAttempts wrong codes.
+// RecoveryCodes is the number of one-time recovery codes handed out when two-factor sign-in is enabled.
+// A device the user chose to remember skips the second factor for TrustedDeviceTTL.
+type MFAConf struct {
+	Issuer           string        `json:"issuer"             mapstructure:"issuer"`
+	Skew             int           `json:"skew"               mapstructure:"skew"`
+	ChallengeTTL     time.Duration `json:"challenge_ttl"      mapstructure:"challenge_ttl"`
+	MaxAttempts      int           `json:"max_attempts"       mapstructure:"max_attempts"`
+	RecoveryCodes    int           `json:"recovery_codes"     mapstructure:"recovery_codes"`
+	TrustedDeviceTTL time.Duration `json:"trusted_device_ttl" mapstructure:"trusted_device_ttl"`
+}
+
+// WebAuthnConf is the relying party passkeys are registered with. RPID is the domain of the frontend and cannot change
+// without losing every registered passkey, Origins are the origins browsers may report. A registration or sign-in
+// ceremony has to be finished within Timeout.
+type WebAuthnConf struct {
+	RPID          string        `json:"rp_id"           mapstructure:"rp_id"`
+	RPDisplayName string        `json:"rp_display_name" mapstructure:"rp_display_name"`
+	Origins       []string      `json:"origins"         mapstructure:"origins"`
+	Timeout       time.Duration `json:"timeout"         mapstructure:"timeout"`
+}
+
+// MagicLinkConf - passwordless sign-in of candidates with an emailed link or code, valid for TTL. The link is URL with
+// the token appended, so URL should point to the page of the frontend that redeems it. A code is dropped after
+// MaxAttempts wrong guesses.
+type MagicLinkConf struct {
 	TTL         time.Duration `json:"ttl"          mapstructure:"ttl"`
-	Domain      string        `json:"domain"       mapstructure:"domain"`
+	URL         string        `json:"url"          mapstructure:"url"`
+	MaxAttempts int           `json:"max_attempts" mapstructure:"max_attempts"`
 }
 
 func New() (*Configs, error) {
@@ -61,7 +280,13 @@ func New() (*Configs, error) {
 		return nil, err
 	}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
+	// times, like active_from and retire_at of signing keys, are RFC 3339 strings, e.g. "2024-05-01T00:00:00Z"
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := viper.Unmarshal(&cfg, hook); err != nil {
 		return nil, err
 	}
 
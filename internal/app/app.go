@@ -11,9 +11,14 @@ import (
 
 	"github.com/Zhiyenbek/users-auth-service/config"
 	handler "github.com/Zhiyenbek/users-auth-service/internal/handler/http"
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
+	"github.com/Zhiyenbek/users-auth-service/internal/mailer"
+	"github.com/Zhiyenbek/users-auth-service/internal/passkey"
+	"github.com/Zhiyenbek/users-auth-service/internal/password"
 	"github.com/Zhiyenbek/users-auth-service/internal/repository"
 	"github.com/Zhiyenbek/users-auth-service/internal/repository/connection"
 	"github.com/Zhiyenbek/users-auth-service/internal/service"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
 	"go.uber.org/zap"
 )
 
@@ -45,9 +50,38 @@ func Run() error {
 			sugar.Errorf("failed to close redis %v", err)
 		}
 	}()
+	keyRing, err := keys.New(cfg.Token, sugar)
+	if err != nil {
+		sugar.Errorf("error while loading signing keys: %v", err)
+		return err
+	}
+	passwords, err := password.New(cfg.Password)
+	if err != nil {
+		sugar.Errorf("error while configuring password hashing: %v", err)
+		return err
+	}
+	breached, err := password.OpenBreachList(cfg.Password.Breached, sugar)
+	if err != nil {
+		sugar.Errorf("error while loading breached passwords: %v", err)
+		return err
+	}
+	defer breached.Close()
+	mail := mailer.New(cfg.Mail, sugar)
+	defer mail.Close()
+	webAuthn, err := passkey.New(cfg.WebAuthn)
+	if err != nil {
+		sugar.Errorf("error while configuring passkeys: %v", err)
+		return err
+	}
 	repos := repository.New(db, cfg, redis, sugar)
-	services := service.New(repos, sugar, cfg)
-	handlers := handler.New(services, sugar, cfg)
+	tokens := token.NewManager(keyRing, cfg.Token)
+	services := service.New(repos, tokens, passwords, breached, mail, webAuthn, sugar, cfg)
+	handlers := handler.New(services, tokens, sugar, cfg)
+	router, err := handlers.InitRoutes()
+	if err != nil {
+		sugar.Errorf("error while setting up routes: %v", err)
+		return err
+	}
 
 	port, ok := os.LookupEnv("PORT")
 	if !ok {
@@ -58,7 +92,7 @@ func Run() error {
 
 	srv := http.Server{
 		Addr:    ":" + port,
-		Handler: handlers.InitRoutes(),
+		Handler: router,
 	}
 	errChan := make(chan error, 1)
 	go func(errChan chan<- error) {
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Types of security relevant events.
+const (
+	RefreshTokenReuse = "refresh_token_reuse"
+	AccountLocked     = "account_locked"
+	AccountUnlocked   = "account_unlocked"
+	MFAEnabled        = "mfa_enabled"
+	RecoveryCodeUsed  = "recovery_code_used"
+	PasskeyRegistered = "passkey_registered"
+	PasskeyCloned     = "passkey_cloned"
+	Reauthenticated   = "reauthenticated"
+)
+
+// Event - a security relevant event about a user
+type Event struct {
+	Type      string
+	PublicID  string
+	SessionID string
+	IP        string
+	UserAgent string
+	Details   map[string]interface{}
+}
+
+// Logger - records audit events
+type Logger interface {
+	Log(event *Event)
+}
+
+type logger struct {
+	log *zap.SugaredLogger
+}
+
+// New creates an audit logger that writes events as structured log entries named "audit".
+func New(log *zap.SugaredLogger) Logger {
+	return &logger{
+		log: log.Named("audit"),
+	}
+}
+
+func (l *logger) Log(event *Event) {
+	fields := []interface{}{
+		"event", event.Type,
+		"public_id", event.PublicID,
+		"session_id", event.SessionID,
+		"ip", event.IP,
+		"user_agent", event.UserAgent,
+		"at", time.Now().UTC(),
+	}
+	for k, v := range event.Details {
+		fields = append(fields, k, v)
+	}
+	l.log.Warnw("audit event", fields...)
+}
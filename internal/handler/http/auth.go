@@ -1,55 +1,68 @@
 package handler
 
 import (
-	"unicode"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
 
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 func (h *handler) TestAuth(c *gin.Context) {
 	c.JSON(200, sendResponse(0, "YOU ARE AUTHORIZED", nil))
 }
 
+// JWKS publishes the public keys that access tokens can be verified with.
+func (h *handler) JWKS(c *gin.Context) {
+	jwks, err := h.tokens.JWKS()
+	if err != nil {
+		h.logger.Errorf("failed to build JWKS: %v", err)
+		c.AbortWithStatusJSON(500, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, jwks)
+}
+
 func (h *handler) RefreshToken(c *gin.Context) {
-	rtToken, err := c.Cookie("refresh_token")
+	rtToken, err := ReadToken(c, refreshTokenCookie, h.cfg.Token.Transport)
 	if err != nil {
 		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 		return
 	}
-	tokens, err := h.service.AuthService.RefreshToken(rtToken)
+	tokens, err := h.service.AuthService.RefreshToken(rtToken, clientInfo(c))
 	if err != nil {
+		if errors.Is(err, models.ErrTokenReused) {
+			h.clearTokenCookies(c)
+		}
 		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidInput))
 		return
 	}
-	c.SetCookie("access_token", tokens.AccessToken.TokenValue, int(tokens.AccessToken.TTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
-	c.SetCookie("refresh_token", tokens.RefreshToken.TokenValue, int(tokens.RefreshToken.TTL.Seconds()), "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
+	h.writeTokens(c, tokens, nil)
+}
 
-	c.JSON(200, sendResponse(0, nil, nil))
+// signInBlocked - responds to a sign-in refused because of too many failed attempts, telling the client when to retry
+func (h *handler) signInBlocked(c *gin.Context, blocked *models.SignInBlockedError) {
+	retryAfter := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, sendResponse(-1, &models.RetryAfterResponse{RetryAfter: retryAfter}, blocked.Unwrap()))
 }
 
-// validatePassword - function that validates password. Password being validated by these requirements:
-// 1.Password must have upper case characters
-// 2.Password must have special characters
-// function returns boolean
-func validatePassword(pass string) bool {
-	var (
-		hasUpper   = false
-		hasLower   = false
-		hasNumber  = false
-		hasSpecial = false
-	)
-	for _, char := range pass {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsNumber(char):
-			hasNumber = true
-		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecial = true
-		}
+// Unlock - lifts the lockout of a login, for administrators authenticated as admin OAuth clients
+func (h *handler) Unlock(c *gin.Context) {
+	req := &models.UnlockRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.Login == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+	err := h.service.AuthService.UnlockLogin(req.Login, c.GetString("client_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		return
 	}
-	return hasUpper && hasLower && hasNumber && hasSpecial
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
 }
@@ -17,16 +17,19 @@ func (h *handler) CandidateSignUp(c *gin.Context) {
 		return
 	}
 
-	if !validatePassword(req.Password) {
-		h.logger.Error("failed to validate password")
-		c.JSON(400, sendResponse(-1, nil, models.ErrWrongCredential))
-		return
-	}
 	err := h.service.CreateCandidate(req)
 	if err != nil {
 		var errMsg error
 		var code int
+		var violation *models.PolicyViolationError
 		switch {
+		case errors.As(err, &violation):
+			h.logger.Error("invalid password")
+			c.JSON(http.StatusBadRequest, sendResponse(-1, violation.Violations, models.ErrInvalidPasswordFormat))
+			return
+		case errors.Is(err, models.ErrPasswordBreached):
+			errMsg = models.ErrPasswordBreached
+			code = http.StatusBadRequest
 		case errors.Is(err, models.ErrUsernameExists):
 			errMsg = models.ErrUsernameExists
 			code = http.StatusBadRequest
@@ -49,44 +52,77 @@ func (h *handler) CandidateSignIn(c *gin.Context) {
 		return
 	}
 
-	switch {
-	case !validatePassword(req.Password):
-		h.logger.Error("invalid password")
-		c.JSON(400, sendResponse(-1, nil, models.ErrInvalidPasswordFormat))
-		return
-	}
-
-	tokens, err := h.service.AuthService.CandidateLogin(req)
+	result, err := h.service.AuthService.CandidateLogin(req, clientInfo(c))
 	if err != nil {
 		h.logger.Errorf("Error occurred while login: %v", err)
+		var blocked *models.SignInBlockedError
 		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
 		case errors.Is(err, models.ErrWrongCredential):
 			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrWrongCredential))
 		default:
 			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
-			return
 		}
+		return
 	}
-	c.SetCookie("access_token", tokens.AccessToken.TokenValue, int(tokens.AccessToken.TTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
-	c.SetCookie("refresh_token", tokens.RefreshToken.TokenValue, int(tokens.RefreshToken.TTL.Seconds()), "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
-	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+	h.writeSignIn(c, result)
 }
 
 func (h *handler) SignOut(c *gin.Context) {
-	cookie, err := c.Cookie("access_token")
+	accessToken, err := ReadToken(c, accessTokenCookie, h.cfg.Token.Transport)
 	if err != nil {
 		h.logger.Error(err)
 		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 		return
 	}
-	// Clear the access_token and refresh_token cookies
-	c.SetCookie("access_token", "", -1, "/", h.cfg.Token.Access.Domain, true, true)
-	c.SetCookie("refresh_token", "", -1, "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
+	h.clearTokenCookies(c)
 
-	err = h.service.AuthService.SignOut(cookie)
+	err = h.service.AuthService.SignOut(accessToken)
 	if err != nil {
 		c.AbortWithStatusJSON(500, sendResponse(-1, nil, models.ErrInternalServer))
 		return
 	}
 	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
 }
+
+// CandidateMagicLink - always answers with success, so that it cannot be used to find out which logins exist
+func (h *handler) CandidateMagicLink(c *gin.Context) {
+	req := &models.MagicLinkRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.Login == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+	if err := h.service.AuthService.SendMagicLink(req, clientInfo(c)); err != nil {
+		h.logger.Errorf("Error occurred while sending magic link: %v", err)
+	}
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
+
+func (h *handler) CandidateRedeemMagicLink(c *gin.Context) {
+	req := &models.RedeemMagicLinkRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || (req.Token == "" && (req.Login == "" || req.Code == "")) {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	result, err := h.service.AuthService.RedeemMagicLink(req, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Error occurred while login with magic link: %v", err)
+		var blocked *models.SignInBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
+		case errors.Is(err, models.ErrWrongCredential):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrWrongCredential))
+		case errors.Is(err, models.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidToken))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	h.writeSignIn(c, result)
+}
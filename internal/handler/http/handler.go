@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"fmt"
+
 	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
 	"github.com/Zhiyenbek/users-auth-service/internal/service"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -10,34 +14,74 @@ import (
 
 type handler struct {
 	service *service.Service
+	tokens  *token.Manager
 	cfg     *config.Configs
 	logger  *zap.SugaredLogger
 }
 
 type Handler interface {
-	InitRoutes() *gin.Engine
+	InitRoutes() (*gin.Engine, error)
 }
 
-func New(services *service.Service, logger *zap.SugaredLogger, cfg *config.Configs) Handler {
+func New(services *service.Service, tokens *token.Manager, logger *zap.SugaredLogger, cfg *config.Configs) Handler {
 	return &handler{
 		service: services,
+		tokens:  tokens,
 		cfg:     cfg,
 		logger:  logger,
 	}
 }
 
-func (h *handler) InitRoutes() *gin.Engine {
+// InitRoutes - sets up the router. Only the configured proxies are trusted to forward the client IP, which throttling
+// and sessions rely on
+func (h *handler) InitRoutes() (*gin.Engine, error) {
 	router := gin.Default()
+	if err := router.SetTrustedProxies(h.cfg.App.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 	router.Use(cors.Default())
 	router.POST("/recruiter/sign-in", h.RecruiterSignIn)
 	router.POST("/candidate/sign-in", h.CandidateSignIn)
+	router.POST("/candidate/magic-link", h.CandidateMagicLink)
+	router.POST("/candidate/magic-link/redeem", h.CandidateRedeemMagicLink)
+	router.POST("/sign-in/mfa", h.MFASignIn)
+	router.POST("/candidate/sign-in/passkey/begin", h.CandidatePasskeySignInBegin)
+	router.POST("/candidate/sign-in/passkey/finish", h.CandidatePasskeySignInFinish)
+	router.POST("/recruiter/sign-in/passkey/begin", h.RecruiterPasskeySignInBegin)
+	router.POST("/recruiter/sign-in/passkey/finish", h.RecruiterPasskeySignInFinish)
 	router.POST("/recruiter/sign-up", h.RecruiterSignUp)
 	router.POST("/candidate/sign-up", h.CandidateSignUp)
 	router.POST("/refresh-token", h.RefreshToken)
 
 	router.POST("/verify", h.VerifyToken, h.TestAuth)
 	router.POST("/sign-out", h.SignOut)
-	return router
+
+	router.GET("/.well-known/jwks.json", h.JWKS)
+
+	oauth := router.Group("/oauth", h.ClientAuth)
+	oauth.POST("/introspect", h.Introspect)
+	oauth.POST("/revoke", h.Revoke)
+
+	admin := router.Group("/admin", h.AdminAuth)
+	admin.POST("/unlock", h.Unlock)
+
+	router.GET("/sessions", h.VerifyToken, h.ListSessions)
+	router.DELETE("/sessions", h.VerifyToken, h.RevokeAllSessions)
+	router.DELETE("/sessions/:id", h.VerifyToken, h.RevokeSession)
+
+	router.POST("/me/password", h.VerifyToken, h.ChangePassword)
+	router.POST("/password/forgot", h.ForgotPassword)
+	router.POST("/password/reset", h.ResetPassword)
+
+	router.POST("/reauthenticate", h.VerifyToken, h.Reauthenticate)
+	recentAuth := RequireRecentAuth(h.cfg.Token.StepUp.MaxAge)
+
+	router.POST("/me/mfa/totp", h.VerifyToken, recentAuth, h.EnrollTOTP)
+	router.POST("/me/mfa/totp/verify", h.VerifyToken, recentAuth, h.EnableTOTP)
+
+	router.POST("/me/passkeys/begin", h.VerifyToken, recentAuth, h.BeginPasskeyRegistration)
+	router.POST("/me/passkeys/finish", h.VerifyToken, recentAuth, h.FinishPasskeyRegistration)
+	return router, nil
 }
 
 func sendResponse(status int, data interface{}, err error) gin.H {
@@ -56,3 +100,17 @@ func sendResponse(status int, data interface{}, err error) gin.H {
 		"error":  errResponse,
 	}
 }
+
+// clientInfo - describes the client of the request. The device token of a trusted device is read from the X-Device-Token
+// header or else the trusted_device cookie
+func clientInfo(c *gin.Context) *models.ClientInfo {
+	deviceToken := c.GetHeader(deviceTokenHeader)
+	if deviceToken == "" {
+		deviceToken, _ = c.Cookie(trustedDeviceCookie)
+	}
+	return &models.ClientInfo{
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		DeviceToken: deviceToken,
+	}
+}
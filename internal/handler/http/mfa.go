@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// EnrollTOTP - answers with the secret, the otpauth URI and a QR code PNG to set up an authenticator app with
+func (h *handler) EnrollTOTP(c *gin.Context) {
+	enrollment, err := h.service.AuthService.EnrollTOTP(c.GetString("public_id"))
+	if err != nil {
+		h.logger.Errorf("Error occurred while enrolling TOTP: %v", err)
+		switch {
+		case errors.Is(err, models.ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrMFAAlreadyEnabled))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, enrollment, nil))
+}
+
+// EnableTOTP - answers with the recovery codes of the user once a code of the authenticator app is verified
+func (h *handler) EnableTOTP(c *gin.Context) {
+	req := &models.TOTPCodeRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.Code == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	codes, err := h.service.AuthService.EnableTOTP(c.GetString("public_id"), req.Code)
+	if err != nil {
+		h.logger.Errorf("Error occurred while enabling TOTP: %v", err)
+		switch {
+		case errors.Is(err, models.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidMFACode))
+		case errors.Is(err, models.ErrMFANotEnrolled):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrMFANotEnrolled))
+		case errors.Is(err, models.ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrMFAAlreadyEnabled))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil))
+}
+
+// MFASignIn - second step of the sign-in of users with two-factor sign-in
+func (h *handler) MFASignIn(c *gin.Context) {
+	req := &models.MFASignInRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	result, err := h.service.AuthService.VerifyMFA(req, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Error occurred while verifying second factor: %v", err)
+		var blocked *models.SignInBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
+		case errors.Is(err, models.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidMFACode))
+		case errors.Is(err, models.ErrInvalidToken):
+			c.JSON(http.StatusUnauthorized, sendResponse(-1, nil, models.ErrInvalidToken))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	h.writeSignIn(c, result)
+}
@@ -2,45 +2,62 @@ package handler
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-func ParseAuthToken(tokenString string, tokenSecret string) (*models.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.JwtUserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not parse token: %v %w", err, models.ErrInvalidInput)
-	}
-	if claims, ok := token.Claims.(*models.JwtUserClaims); ok && token.Valid {
-		token := &models.Token{
-			PublicID:   claims.PublicID,
-			Role:       claims.Role,
-			TokenValue: tokenString,
-			TTL:        time.Duration(claims.ExpiresAt),
-		}
-		return token, nil
-	}
-	return nil, fmt.Errorf("could not parse token: %w", models.ErrInvalidToken)
-}
-
 func (h *handler) VerifyToken(c *gin.Context) {
-	jwtToken, err := c.Cookie("access_token")
+	jwtToken, err := ReadToken(c, accessTokenCookie, h.cfg.Token.Transport)
 	if err != nil {
 		h.logger.Error(err)
 		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 		return
 	}
-	_, err = ParseAuthToken(jwtToken, h.cfg.Token.Access.TokenSecret)
+	token, err := h.tokens.Parse(jwtToken, models.AccessTokenType)
 	if err != nil {
 		h.logger.Error(err)
 		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 		return
 	}
+	revoked, err := h.service.AuthService.IsRevoked(token)
+	if err != nil {
+		c.AbortWithStatusJSON(500, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+	if revoked {
+		h.logger.Errorf("access token %s of session %s is revoked", token.ID, token.SessionID)
+		c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
+		return
+	}
+	c.Set("role", token.Role)
+	c.Set("public_id", token.PublicID)
+	c.Set("session_id", token.SessionID)
+	SetAuthContext(c, token)
 	// Pass on to the next-in-chain
 	c.Next()
 }
+
+// SetAuthContext - keeps the auth_time, amr and acr of a verified access token for RequireRecentAuth and handlers
+func SetAuthContext(c *gin.Context, token *models.Token) {
+	c.Set("auth_time", token.AuthTime)
+	c.Set("amr", token.AMR)
+	c.Set("acr", token.ACR)
+}
+
+// RequireRecentAuth - lets only requests through whose user signed in or reauthenticated within maxAge. It has to run
+// after the access token was verified. Others are refused as described in RFC 9470, with a challenge that tells
+// the client to get an elevated token from POST /reauthenticate
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authTime, _ := c.Value("auth_time").(time.Time)
+		if authTime.IsZero() || time.Since(authTime) > maxAge {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(maxAge.Seconds())))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, sendResponse(-1, nil, models.ErrReauthRequired))
+			return
+		}
+		c.Next()
+	}
+}
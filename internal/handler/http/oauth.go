@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/gin-gonic/gin"
+)
+
+// oauthError - error response of the OAuth 2.0 endpoints as described in RFC 6749 section 5.2
+func oauthError(code string) gin.H {
+	return gin.H{"error": code}
+}
+
+// ClientAuth - authenticates OAuth clients with HTTP Basic credentials or client_id and client_secret form parameters
+func (h *handler) ClientAuth(c *gin.Context) {
+	h.authenticateClient(c, false)
+}
+
+// AdminAuth - authenticates OAuth clients like ClientAuth and lets through only the clients marked as admin
+func (h *handler) AdminAuth(c *gin.Context) {
+	h.authenticateClient(c, true)
+}
+
+func (h *handler) authenticateClient(c *gin.Context, admin bool) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	client := h.validClient(clientID, secret)
+	if client == nil {
+		h.logger.Errorf("oauth client %q failed to authenticate", clientID)
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, oauthError("invalid_client"))
+		return
+	}
+	if admin && !client.Admin {
+		h.logger.Errorf("oauth client %q is not allowed to call admin endpoints", clientID)
+		c.AbortWithStatusJSON(http.StatusForbidden, oauthError("unauthorized_client"))
+		return
+	}
+	c.Set("client_id", clientID)
+	c.Next()
+}
+
+// validClient - returns the client with the credentials, nil if they are wrong
+func (h *handler) validClient(clientID, secret string) *config.OAuthClient {
+	if h.cfg.OAuth == nil || clientID == "" {
+		return nil
+	}
+	// secrets are compared as hashes so that the comparison takes the same time whatever their length
+	given := sha256.Sum256([]byte(secret))
+	for _, client := range h.cfg.OAuth.Clients {
+		if client.ID != clientID {
+			continue
+		}
+		expected := sha256.Sum256([]byte(client.Secret))
+		if subtle.ConstantTimeCompare(given[:], expected[:]) == 1 {
+			return client
+		}
+		return nil
+	}
+	return nil
+}
+
+// Introspect - OAuth 2.0 token introspection endpoint (RFC 7662)
+func (h *handler) Introspect(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, oauthError("invalid_request"))
+		return
+	}
+	resp, err := h.service.AuthService.Introspect(token, c.PostForm("token_type_hint"))
+	if err != nil {
+		h.logger.Errorf("Error occurred while introspecting token: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, oauthError("server_error"))
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke - OAuth 2.0 token revocation endpoint (RFC 7009). Invalid tokens do not cause an error
+func (h *handler) Revoke(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, oauthError("invalid_request"))
+		return
+	}
+	err := h.service.AuthService.RevokeToken(token, c.PostForm("token_type_hint"))
+	if err != nil {
+		h.logger.Errorf("Error occurred while revoking token: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, oauthError("server_error"))
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// BeginPasskeyRegistration - answers with the options for navigator.credentials.create
+func (h *handler) BeginPasskeyRegistration(c *gin.Context) {
+	creation, err := h.service.AuthService.BeginPasskeyRegistration(c.GetString("public_id"))
+	if err != nil {
+		h.logger.Errorf("Error occurred while beginning passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, creation, nil))
+}
+
+// FinishPasskeyRegistration - takes the credential returned by navigator.credentials.create as the request body
+func (h *handler) FinishPasskeyRegistration(c *gin.Context) {
+	response, err := protocol.ParseCredentialCreationResponseBody(c.Request.Body)
+	if err != nil {
+		h.logger.Errorf("ERROR: invalid passkey registration response: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	err = h.service.AuthService.FinishPasskeyRegistration(c.GetString("public_id"), response)
+	if err != nil {
+		h.logger.Errorf("Error occurred while finishing passkey registration: %v", err)
+		switch {
+		case errors.Is(err, models.ErrInvalidPasskey):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidPasskey))
+		case errors.Is(err, models.ErrPasskeyExists):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrPasskeyExists))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, sendResponse(0, nil, nil))
+}
+
+func (h *handler) CandidatePasskeySignInBegin(c *gin.Context) {
+	h.beginPasskeySignIn(c, models.RoleCandidate)
+}
+
+func (h *handler) CandidatePasskeySignInFinish(c *gin.Context) {
+	h.finishPasskeySignIn(c, models.RoleCandidate)
+}
+
+func (h *handler) RecruiterPasskeySignInBegin(c *gin.Context) {
+	h.beginPasskeySignIn(c, models.RoleRecruiter)
+}
+
+func (h *handler) RecruiterPasskeySignInFinish(c *gin.Context) {
+	h.finishPasskeySignIn(c, models.RoleRecruiter)
+}
+
+// beginPasskeySignIn - answers with the options for navigator.credentials.get
+func (h *handler) beginPasskeySignIn(c *gin.Context, role string) {
+	assertion, err := h.service.AuthService.BeginPasskeySignIn(role)
+	if err != nil {
+		h.logger.Errorf("Error occurred while beginning passkey sign-in: %v", err)
+		c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, assertion, nil))
+}
+
+// finishPasskeySignIn - takes the credential returned by navigator.credentials.get as the request body
+func (h *handler) finishPasskeySignIn(c *gin.Context, role string) {
+	response, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+	if err != nil {
+		h.logger.Errorf("ERROR: invalid passkey sign-in response: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	result, err := h.service.AuthService.FinishPasskeySignIn(role, response, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Error occurred while login with passkey: %v", err)
+		switch {
+		case errors.Is(err, models.ErrInvalidPasskey):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidPasskey))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	h.writeSignIn(c, result)
+}
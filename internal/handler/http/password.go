@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func (h *handler) ChangePassword(c *gin.Context) {
+	req := &models.ChangePasswordRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	err := h.service.AuthService.ChangePassword(c.GetString("public_id"), c.GetString("session_id"), req, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Error occurred while changing password: %v", err)
+		var violation *models.PolicyViolationError
+		var blocked *models.SignInBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
+		case errors.As(err, &violation):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, violation.Violations, models.ErrInvalidPasswordFormat))
+		case errors.Is(err, models.ErrPasswordBreached):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrPasswordBreached))
+		case errors.Is(err, models.ErrPasswordReused):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrPasswordReused))
+		case errors.Is(err, models.ErrWrongCredential):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrWrongCredential))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
+
+// ForgotPassword - always answers with success, so that it cannot be used to find out which logins exist
+func (h *handler) ForgotPassword(c *gin.Context) {
+	req := &models.ForgotPasswordRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.Login == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+	if err := h.service.AuthService.ForgotPassword(req, clientInfo(c)); err != nil {
+		h.logger.Errorf("Error occurred while sending password reset link: %v", err)
+	}
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
+
+func (h *handler) ResetPassword(c *gin.Context) {
+	req := &models.ResetPasswordRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || req.Token == "" || req.NewPassword == "" {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	err := h.service.AuthService.ResetPassword(req)
+	if err != nil {
+		h.logger.Errorf("Error occurred while resetting password: %v", err)
+		var violation *models.PolicyViolationError
+		switch {
+		case errors.As(err, &violation):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, violation.Violations, models.ErrInvalidPasswordFormat))
+		case errors.Is(err, models.ErrPasswordBreached):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrPasswordBreached))
+		case errors.Is(err, models.ErrPasswordReused):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrPasswordReused))
+		case errors.Is(err, models.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidToken))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	h.clearTokenCookies(c)
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
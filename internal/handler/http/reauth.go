@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Reauthenticate - answers with an elevated short-lived access token once the signed in user proved again who they are.
+// The refresh token stays the same, so the client falls back to a regular access token by refreshing
+func (h *handler) Reauthenticate(c *gin.Context) {
+	req := &models.ReauthenticateRequest{}
+	if err := c.ShouldBindWith(req, binding.JSON); err != nil || (req.Password == "" && req.Code == "" && req.RecoveryCode == "") {
+		h.logger.Errorf("ERROR: invalid input, some fields are incorrect: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidInput))
+		return
+	}
+
+	token, err := h.service.AuthService.Reauthenticate(c.GetString("public_id"), c.GetString("session_id"), c.GetString("role"), req, clientInfo(c))
+	if err != nil {
+		h.logger.Errorf("Error occurred while reauthenticating: %v", err)
+		var blocked *models.SignInBlockedError
+		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
+		case errors.Is(err, models.ErrWrongCredential):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrWrongCredential))
+		case errors.Is(err, models.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrInvalidMFACode))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+
+	var data *models.SignInResponse
+	if models.UsesCookies(h.cfg.Token.Transport) {
+		c.SetCookie(accessTokenCookie, token.TokenValue, int(token.TTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
+	}
+	if h.tokensInBody(c) {
+		data = &models.SignInResponse{
+			AccessToken: token.TokenValue,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(token.TTL.Seconds()),
+		}
+	}
+	c.JSON(http.StatusOK, sendResponse(0, data, nil))
+}
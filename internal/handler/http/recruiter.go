@@ -22,18 +22,19 @@ func (h *handler) RecruiterSignUp(c *gin.Context) {
 		c.AbortWithStatusJSON(400, sendResponse(-1, nil, models.ErrInvalidInput))
 		return
 	}
-	switch {
-	case !validatePassword(req.Password):
-		h.logger.Error("invalid password")
-		c.JSON(400, sendResponse(-1, nil, models.ErrInvalidPasswordFormat))
-		return
-	}
-
 	err := h.service.CreateRecruiter(req)
 	if err != nil {
 		var errMsg error
 		var code int
+		var violation *models.PolicyViolationError
 		switch {
+		case errors.As(err, &violation):
+			h.logger.Error("invalid password")
+			c.JSON(http.StatusBadRequest, sendResponse(-1, violation.Violations, models.ErrInvalidPasswordFormat))
+			return
+		case errors.Is(err, models.ErrPasswordBreached):
+			errMsg = models.ErrPasswordBreached
+			code = http.StatusBadRequest
 		case errors.Is(err, models.ErrCompanyDoesntExists):
 			errMsg = models.ErrCompanyDoesntExists
 			code = http.StatusBadRequest
@@ -56,23 +57,19 @@ func (h *handler) RecruiterSignIn(c *gin.Context) {
 		return
 	}
 
-	if !validatePassword(req.Password) {
-		h.logger.Error("failed to validate password")
-		c.JSON(400, sendResponse(-1, nil, models.ErrWrongCredential))
-		return
-	}
-	tokens, err := h.service.AuthService.RecruiterLogin(req)
+	result, err := h.service.AuthService.RecruiterLogin(req, clientInfo(c))
 	if err != nil {
 		h.logger.Errorf("Error occurred while login: %v", err)
+		var blocked *models.SignInBlockedError
 		switch {
+		case errors.As(err, &blocked):
+			h.signInBlocked(c, blocked)
 		case errors.Is(err, models.ErrWrongCredential):
 			c.JSON(http.StatusBadRequest, sendResponse(-1, nil, models.ErrWrongCredential))
 		default:
 			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
-			return
 		}
+		return
 	}
-	c.SetCookie("access_token", tokens.AccessToken.TokenValue, int(tokens.AccessToken.TTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
-	c.SetCookie("refresh_token", tokens.RefreshToken.TokenValue, int(tokens.RefreshToken.TTL.Seconds()), "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
-	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+	h.writeSignIn(c, result)
 }
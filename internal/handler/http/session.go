@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *handler) ListSessions(c *gin.Context) {
+	publicID := c.GetString("public_id")
+	sessions, err := h.service.AuthService.ListSessions(publicID)
+	if err != nil {
+		h.logger.Errorf("Error occurred while listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+
+	currentID := c.GetString("session_id")
+	resp := make([]*models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, &models.SessionResponse{
+			ID:            session.ID,
+			CreatedAt:     session.CreatedAt,
+			LastRefreshAt: session.LastRefreshAt,
+			UserAgent:     session.UserAgent,
+			IP:            session.IP,
+			Current:       session.ID == currentID,
+		})
+	}
+	c.JSON(http.StatusOK, sendResponse(0, resp, nil))
+}
+
+func (h *handler) RevokeSession(c *gin.Context) {
+	publicID := c.GetString("public_id")
+	sessionID := c.Param("id")
+	err := h.service.AuthService.RevokeSession(publicID, sessionID)
+	if err != nil {
+		h.logger.Errorf("Error occurred while revoking session: %v", err)
+		switch {
+		case errors.Is(err, models.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, sendResponse(-1, nil, models.ErrSessionNotFound))
+		default:
+			c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		}
+		return
+	}
+	if sessionID == c.GetString("session_id") {
+		h.clearTokenCookies(c)
+	}
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
+
+func (h *handler) RevokeAllSessions(c *gin.Context) {
+	publicID := c.GetString("public_id")
+	err := h.service.AuthService.RevokeAllSessions(publicID)
+	if err != nil {
+		h.logger.Errorf("Error occurred while revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, sendResponse(-1, nil, models.ErrInternalServer))
+		return
+	}
+	h.clearTokenCookies(c)
+	c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	accessTokenCookie   = "access_token"
+	refreshTokenCookie  = "refresh_token"
+	trustedDeviceCookie = "trusted_device"
+	deviceTokenHeader   = "X-Device-Token"
+	// clients of the both transport that keep tokens themselves ask for them in response bodies with
+	// X-Token-Transport: bearer
+	tokenTransportHeader = "X-Token-Transport"
+)
+
+var errNoToken = errors.New("token not found in request")
+
+// ReadToken - reads a token from the Authorization: Bearer header and/or the named cookie, as allowed by transport
+func ReadToken(c *gin.Context, cookieName string, transport string) (string, error) {
+	if models.UsesBearer(transport) {
+		if token, ok := bearerToken(c); ok {
+			return token, nil
+		}
+	}
+	if models.UsesCookies(transport) {
+		return c.Cookie(cookieName)
+	}
+	return "", errNoToken
+}
+
+// bearerToken - reads the token of the Authorization: Bearer header
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):]), true
+	}
+	return "", false
+}
+
+// tokensInBody - tells whether tokens are returned in the response body. The bearer transport always returns them,
+// the both transport only to clients that ask for them with the X-Token-Transport header or send a bearer token,
+// so that tokens of browsers stay in HttpOnly cookies out of reach of scripts
+func (h *handler) tokensInBody(c *gin.Context) bool {
+	switch h.cfg.Token.Transport {
+	case models.TransportBearer:
+		return true
+	case models.TransportBoth:
+		if strings.EqualFold(c.GetHeader(tokenTransportHeader), models.TransportBearer) {
+			return true
+		}
+		_, ok := bearerToken(c)
+		return ok
+	default:
+		return false
+	}
+}
+
+// writeTokens - hands the tokens out as cookies and/or in the response body, depending on the configured transport
+// and, for the both transport, on whether the client asked for them in the body
+func (h *handler) writeTokens(c *gin.Context, tokens *models.Tokens, data *models.SignInResponse) {
+	if models.UsesCookies(h.cfg.Token.Transport) {
+		c.SetCookie(accessTokenCookie, tokens.AccessToken.TokenValue, int(tokens.AccessToken.TTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
+		c.SetCookie(refreshTokenCookie, tokens.RefreshToken.TokenValue, int(tokens.RefreshToken.TTL.Seconds()), "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
+	}
+	if h.tokensInBody(c) {
+		if data == nil {
+			data = &models.SignInResponse{}
+		}
+		data.AccessToken = tokens.AccessToken.TokenValue
+		data.RefreshToken = tokens.RefreshToken.TokenValue
+		data.TokenType = "Bearer"
+		data.ExpiresIn = int(tokens.AccessToken.TTL.Seconds())
+	}
+	if data == nil {
+		c.JSON(http.StatusOK, sendResponse(0, nil, nil))
+		return
+	}
+	c.JSON(http.StatusOK, sendResponse(0, data, nil))
+}
+
+// writeSignIn - hands out the tokens of a sign-in and tells the client whether the password has to be changed.
+// A sign-in waiting for the second factor only gets the MFA token. A remembered device gets the device token like
+// the other tokens, as a cookie browsers send along with the next sign-in and/or in the body for the X-Device-Token header
+func (h *handler) writeSignIn(c *gin.Context, result *models.SignInResult) {
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, sendResponse(0, &models.SignInResponse{MFARequired: true, MFAToken: result.MFAToken}, nil))
+		return
+	}
+	var data *models.SignInResponse
+	if result.PasswordChangeRequired {
+		data = &models.SignInResponse{PasswordChangeRequired: true}
+	}
+	if result.DeviceToken != "" {
+		if models.UsesCookies(h.cfg.Token.Transport) {
+			c.SetCookie(trustedDeviceCookie, result.DeviceToken, int(h.cfg.MFA.TrustedDeviceTTL.Seconds()), "/", h.cfg.Token.Access.Domain, true, true)
+		}
+		if h.tokensInBody(c) {
+			if data == nil {
+				data = &models.SignInResponse{}
+			}
+			data.DeviceToken = result.DeviceToken
+		}
+	}
+	h.writeTokens(c, result.Tokens, data)
+}
+
+// clearTokenCookies - clears the access_token and refresh_token cookies
+func (h *handler) clearTokenCookies(c *gin.Context) {
+	if !models.UsesCookies(h.cfg.Token.Transport) {
+		return
+	}
+	c.SetCookie(accessTokenCookie, "", -1, "/", h.cfg.Token.Access.Domain, true, true)
+	c.SetCookie(refreshTokenCookie, "", -1, "/refresh-token", h.cfg.Token.Refresh.Domain, true, true)
+}
@@ -0,0 +1,275 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"go.uber.org/zap"
+)
+
+// Supported asymmetric signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Algorithms is the allowlist of algorithms accepted when verifying tokens.
+var Algorithms = []string{AlgRS256, AlgES256, AlgEdDSA}
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// Key is an asymmetric key identified by its kid. Private is nil for keys that can only verify.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// Verifier returns the public key that must be used to verify a token signed with the given kid.
+type Verifier interface {
+	VerificationKey(kid string) (*Key, error)
+}
+
+// entry is a key of the ring together with its schedule.
+type entry struct {
+	key        *Key
+	activeFrom time.Time
+	retireAt   time.Time
+}
+
+// Ring holds the keys of this service. Exactly one of them signs new tokens at any moment,
+// while every key that is not retired yet is published as a JWKS and accepted for verification.
+// Keys are switched and retired according to their schedule, so rotations need no restart.
+type Ring struct {
+	entries []*entry
+	now     func() time.Time
+}
+
+func New(cfg *config.Token, logger *zap.SugaredLogger) (*Ring, error) {
+	if cfg.Signing == nil || len(cfg.Signing.Keys) == 0 {
+		return nil, errors.New("token signing keys are not configured")
+	}
+	overlap := cfg.Signing.Overlap
+	if overlap == 0 {
+		overlap = cfg.Access.TTL
+		if cfg.Refresh.TTL > overlap {
+			overlap = cfg.Refresh.TTL
+		}
+	}
+
+	entries := make([]*entry, 0, len(cfg.Signing.Keys))
+	seen := make(map[string]bool, len(cfg.Signing.Keys))
+	for _, kc := range cfg.Signing.Keys {
+		if kc.ID == "" {
+			return nil, errors.New("signing key id is empty")
+		}
+		if seen[kc.ID] {
+			return nil, fmt.Errorf("duplicate signing key id %q", kc.ID)
+		}
+		seen[kc.ID] = true
+		if !kc.RetireAt.IsZero() && !kc.RetireAt.After(kc.ActiveFrom) {
+			return nil, fmt.Errorf("signing key %q is retired before it becomes active", kc.ID)
+		}
+
+		var (
+			key *Key
+			err error
+		)
+		if kc.PrivateKeyPath == "" {
+			if !cfg.Signing.AllowEphemeral {
+				return nil, fmt.Errorf("private key path for signing key %q is not set", kc.ID)
+			}
+			logger.Warnf("private key path for signing key %q is not set, generating ephemeral %s key", kc.ID, kc.Algorithm)
+			key, err = Generate(kc.ID, kc.Algorithm)
+		} else {
+			key, err = LoadFile(kc.ID, kc.Algorithm, kc.PrivateKeyPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry{key: key, activeFrom: kc.ActiveFrom, retireAt: kc.RetireAt})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].activeFrom.Before(entries[j].activeFrom)
+	})
+	for i, e := range entries {
+		if i+1 == len(entries) {
+			break
+		}
+		next := entries[i+1].activeFrom
+		if next.Equal(e.activeFrom) {
+			return nil, fmt.Errorf("signing keys %q and %q become active at the same time", e.key.ID, entries[i+1].key.ID)
+		}
+		if e.retireAt.IsZero() {
+			e.retireAt = next.Add(overlap)
+		}
+	}
+
+	ring := &Ring{entries: entries, now: time.Now}
+	if ring.SigningKey() == nil {
+		return nil, errors.New("no signing key is active yet")
+	}
+	for _, e := range entries {
+		if !e.retireAt.IsZero() {
+			logger.Infof("signing key %q is active from %v and retires at %v", e.key.ID, e.activeFrom, e.retireAt)
+		}
+	}
+	return ring, nil
+}
+
+// SigningKey returns the key that new tokens must be signed with: the most recently activated key that is not retired.
+func (r *Ring) SigningKey() *Key {
+	now := r.now()
+	var signing *Key
+	for _, e := range r.entries {
+		if e.activeFrom.After(now) {
+			break
+		}
+		if !e.retired(now) {
+			signing = e.key
+		}
+	}
+	return signing
+}
+
+// VerificationKey returns any key of the ring that is not retired, including keys scheduled for future activation.
+func (r *Ring) VerificationKey(kid string) (*Key, error) {
+	now := r.now()
+	for _, e := range r.entries {
+		if e.key.ID != kid {
+			continue
+		}
+		if e.retired(now) {
+			return nil, fmt.Errorf("%w: %q is retired", ErrKeyNotFound, kid)
+		}
+		return e.key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+}
+
+// JWKS returns the public part of the keys that tokens may be verified with.
+func (r *Ring) JWKS() (*JWKS, error) {
+	now := r.now()
+	set := &JWKS{Keys: []*JWK{}}
+	for _, e := range r.entries {
+		if e.retired(now) {
+			continue
+		}
+		jwk, err := NewJWK(e.key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+func (e *entry) retired(now time.Time) bool {
+	return !e.retireAt.IsZero() && !now.Before(e.retireAt)
+}
+
+// Generate creates a new random key for the algorithm.
+func Generate(kid, alg string) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(kid, alg, private)
+}
+
+// LoadFile reads a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1) from path.
+func LoadFile(kid, alg, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read signing key %q: %w", kid, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q: no PEM data found in %s", kid, path)
+	}
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse signing key %q: %w", kid, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %q: unsupported key type %T", kid, private)
+	}
+	return newKey(kid, alg, signer)
+}
+
+func newKey(kid, alg string, private crypto.Signer) (*Key, error) {
+	key := &Key{
+		ID:        kid,
+		Algorithm: alg,
+		Private:   private,
+		Public:    private.Public(),
+	}
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// validate checks that the key material matches the declared algorithm.
+func (k *Key) validate() error {
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		if k.Algorithm != AlgRS256 {
+			break
+		}
+		if pub.N.BitLen() < 2048 {
+			return fmt.Errorf("signing key %q: RSA keys must be at least 2048 bits", k.ID)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if k.Algorithm != AlgES256 {
+			break
+		}
+		if pub.Curve != elliptic.P256() {
+			return fmt.Errorf("signing key %q: ES256 requires a P-256 key", k.ID)
+		}
+		return nil
+	case ed25519.PublicKey:
+		if k.Algorithm == AlgEdDSA {
+			return nil
+		}
+	}
+	return fmt.Errorf("signing key %q: %T can not be used with algorithm %q", k.ID, k.Public, k.Algorithm)
+}
@@ -0,0 +1,127 @@
+package keys
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"go.uber.org/zap"
+)
+
+// newTestRing - a ring of ephemeral ES256 keys whose clock is set with the returned function
+func newTestRing(t *testing.T, overlap time.Duration, keys ...*config.SigningKeyConf) (*Ring, func(time.Time)) {
+	t.Helper()
+	for _, kc := range keys {
+		kc.Algorithm = AlgES256
+	}
+	cfg := &config.Token{
+		Access:  &config.TokenConf{TTL: 15 * time.Minute},
+		Refresh: &config.TokenConf{TTL: time.Hour},
+		Signing: &config.SigningConf{Overlap: overlap, AllowEphemeral: true, Keys: keys},
+	}
+	ring, err := New(cfg, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring, func(now time.Time) {
+		ring.now = func() time.Time { return now }
+	}
+}
+
+// published - the kids of the JWKS of the ring
+func published(t *testing.T, ring *Ring) []string {
+	t.Helper()
+	set, err := ring.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids := make([]string, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		kids = append(kids, jwk.KeyID)
+	}
+	return kids
+}
+
+func TestRingSchedule(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	activation := start.Add(time.Hour)
+	overlap := 30 * time.Minute
+	ring, setNow := newTestRing(t, overlap,
+		&config.SigningKeyConf{ID: "old", ActiveFrom: start.Add(-time.Hour)},
+		&config.SigningKeyConf{ID: "new", ActiveFrom: activation},
+	)
+
+	steps := []struct {
+		name      string
+		now       time.Time
+		signing   string
+		verifying []string
+		retired   []string
+	}{
+		{"before activation", activation.Add(-time.Second), "old", []string{"old", "new"}, nil},
+		{"at activation", activation, "new", []string{"old", "new"}, nil},
+		{"during overlap", activation.Add(overlap - time.Second), "new", []string{"old", "new"}, nil},
+		{"at retirement", activation.Add(overlap), "new", []string{"new"}, []string{"old"}},
+		{"after retirement", activation.Add(2 * overlap), "new", []string{"new"}, []string{"old"}},
+	}
+	for _, step := range steps {
+		setNow(step.now)
+		if key := ring.SigningKey(); key == nil || key.ID != step.signing {
+			t.Fatalf("%s: signing key %+v, want %q", step.name, key, step.signing)
+		}
+		for _, kid := range step.verifying {
+			if _, err := ring.VerificationKey(kid); err != nil {
+				t.Fatalf("%s: verification key %q: %v", step.name, kid, err)
+			}
+		}
+		for _, kid := range step.retired {
+			if _, err := ring.VerificationKey(kid); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("%s: retired key %q: got %v, want %v", step.name, kid, err, ErrKeyNotFound)
+			}
+		}
+		if kids := published(t, ring); !reflect.DeepEqual(kids, step.verifying) {
+			t.Fatalf("%s: published %v, want %v", step.name, kids, step.verifying)
+		}
+	}
+}
+
+func TestRingScheduleRetireAt(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	activation := start.Add(time.Hour)
+	retireAt := activation.Add(5 * time.Minute)
+	ring, setNow := newTestRing(t, time.Hour,
+		&config.SigningKeyConf{ID: "old", ActiveFrom: start.Add(-time.Hour), RetireAt: retireAt},
+		&config.SigningKeyConf{ID: "new", ActiveFrom: activation},
+	)
+
+	// retire_at of the configuration wins over the overlap
+	setNow(retireAt.Add(-time.Second))
+	if _, err := ring.VerificationKey("old"); err != nil {
+		t.Fatalf("before retire_at: %v", err)
+	}
+	setNow(retireAt)
+	if _, err := ring.VerificationKey("old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("at retire_at: got %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestRingDefaultOverlap(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	activation := start.Add(time.Hour)
+	// without an overlap, superseded keys verify for as long as the longest token lives
+	ring, setNow := newTestRing(t, 0,
+		&config.SigningKeyConf{ID: "old", ActiveFrom: start.Add(-time.Hour)},
+		&config.SigningKeyConf{ID: "new", ActiveFrom: activation},
+	)
+
+	setNow(activation.Add(time.Hour - time.Second))
+	if _, err := ring.VerificationKey("old"); err != nil {
+		t.Fatalf("within the refresh token TTL: %v", err)
+	}
+	setNow(activation.Add(time.Hour))
+	if _, err := ring.VerificationKey("old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("after the refresh token TTL: got %v, want %v", err, ErrKeyNotFound)
+	}
+}
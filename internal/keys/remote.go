@@ -0,0 +1,115 @@
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// remoteRefreshInterval limits how often an unknown kid may trigger a new JWKS download.
+	remoteRefreshInterval = time.Minute
+	// remoteMaxAge is how long downloaded keys are trusted before the JWKS is fetched again,
+	// so that retired keys stop being accepted.
+	remoteMaxAge = 15 * time.Minute
+	// remoteRetryInterval is how long to wait before downloading the JWKS again after a failed download.
+	remoteRetryInterval = 5 * time.Second
+)
+
+// Remote verifies tokens with the public keys published on a JWKS endpoint.
+// It is meant for services that consume tokens issued by this service.
+type Remote struct {
+	url    string
+	client *http.Client
+
+	// fetchMu lets one download of the JWKS run at a time, failedAt is guarded by it
+	fetchMu  sync.Mutex
+	failedAt time.Time
+
+	// mu guards the downloaded keys and when they were downloaded
+	mu        sync.RWMutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+}
+
+func NewRemote(url string) *Remote {
+	return &Remote{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   map[string]*Key{},
+	}
+}
+
+func (r *Remote) VerificationKey(kid string) (*Key, error) {
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	stale := time.Since(r.fetchedAt) > remoteMaxAge
+	r.mu.RUnlock()
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := r.refresh(); err != nil && !ok {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok = r.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+	return key, nil
+}
+
+// refresh - downloads the JWKS unless it was downloaded within remoteRefreshInterval or failed within
+// remoteRetryInterval. The download happens outside of mu, so verifications with known keys are not held up by it
+func (r *Remote) refresh() error {
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+	r.mu.RLock()
+	fetchedAt := r.fetchedAt
+	r.mu.RUnlock()
+	if time.Since(fetchedAt) < remoteRefreshInterval || time.Since(r.failedAt) < remoteRetryInterval {
+		return nil
+	}
+
+	keys, err := r.fetch()
+	if err != nil {
+		r.failedAt = time.Now()
+		return err
+	}
+	r.mu.Lock()
+	r.keys = keys
+	r.fetchedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// fetch - downloads the JWKS and parses its keys
+func (r *Remote) fetch() (map[string]*Key, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+	set := &JWKS{}
+	if err := json.NewDecoder(resp.Body).Decode(set); err != nil {
+		return nil, fmt.Errorf("could not decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.Key()
+		if err != nil {
+			return nil, err
+		}
+		keys[key.ID] = key
+	}
+	return keys, nil
+}
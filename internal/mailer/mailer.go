@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"go.uber.org/zap"
+)
+
+const defaultQueueSize = 100
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Message - a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - queues emails for delivery
+type Mailer interface {
+	Send(msg *Message) error
+	Close()
+}
+
+// smtpMailer delivers queued messages over SMTP in the background, so that request handling
+// neither waits for the mail server nor takes longer for users that get an email.
+type smtpMailer struct {
+	cfg    *config.MailConf
+	addr   string
+	auth   smtp.Auth
+	logger *zap.SugaredLogger
+
+	queue chan *Message
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+func New(cfg *config.MailConf, logger *zap.SugaredLogger) Mailer {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	m := &smtpMailer{
+		cfg:    cfg,
+		addr:   net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		logger: logger.Named("mailer"),
+		queue:  make(chan *Message, queueSize),
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	m.wg.Add(1)
+	go m.run()
+	return m
+}
+
+// Send - queues the message. It fails only if the queue is full, delivery errors are logged
+func (m *smtpMailer) Send(msg *Message) error {
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return fmt.Errorf("%w, message to %s is dropped", ErrQueueFull, msg.To)
+	}
+}
+
+// Close - stops accepting messages and waits until the queued ones are delivered
+func (m *smtpMailer) Close() {
+	m.once.Do(func() {
+		close(m.queue)
+	})
+	m.wg.Wait()
+}
+
+func (m *smtpMailer) run() {
+	defer m.wg.Done()
+	for msg := range m.queue {
+		if err := smtp.SendMail(m.addr, m.auth, m.cfg.From, []string{msg.To}, m.build(msg)); err != nil {
+			m.logger.Errorf("could not send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}
+}
+
+func (m *smtpMailer) build(msg *Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
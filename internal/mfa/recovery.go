@@ -0,0 +1,34 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// recoveryCodeLength is the number of characters of a recovery code, 80 bits of entropy in base32
+const recoveryCodeLength = 16
+
+// NewRecoveryCodes - returns n random recovery codes formatted like XXXX-XXXX-XXXX-XXXX for readability
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	b := make([]byte, recoveryCodeLength*5/8)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("could not generate recovery code: %v", err)
+		}
+		code := encoding.EncodeToString(b)
+		groups := make([]string, 0, recoveryCodeLength/4)
+		for j := 0; j < len(code); j += 4 {
+			groups = append(groups, code[j:j+4])
+		}
+		codes[i] = strings.Join(groups, "-")
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode - returns the code in the form it is hashed in, users may type it in lower case and without dashes
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,108 @@
+// Package mfa implements the second factors users may sign in with: time-based one-time passwords as described
+// in RFC 6238 and one-time recovery codes for when the authenticator is lost.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Parameters of the generated codes. They are the defaults of authenticator apps, some of which ignore any others
+const (
+	Period = 30 * time.Second
+	Digits = 6
+	// SecretLength is the length of secrets in bytes, the size of an HMAC-SHA1 key recommended by RFC 4226
+	SecretLength = 20
+	// QRCodeSize is the width and height of QR code images in pixels
+	QRCodeSize = 256
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret - returns a random base32 encoded TOTP secret
+func NewSecret() (string, error) {
+	b := make([]byte, SecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate TOTP secret: %v", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI - returns the otpauth URI authenticator apps are set up with, see
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// QRCode - returns a PNG image of a QR code holding the URI, for authenticator apps to scan
+func QRCode(uri string) ([]byte, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, QRCodeSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate QR code: %v", err)
+	}
+	return png, nil
+}
+
+// Step - returns the number of the time step t falls into
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code - returns the code of the time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate - checks the code against the time step of now and skew steps before and after it, so that clocks may drift.
+// It returns the step the code belongs to, so that callers can refuse a code that was already used
+func Validate(secret, code string, now time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
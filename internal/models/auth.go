@@ -2,8 +2,6 @@ package models
 
 import (
 	"time"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
 type UserSignInRequest struct {
@@ -16,6 +14,49 @@ type UserData struct {
 	Password  string `json:"password"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	// PepperVersion is the version of the pepper Password was hashed with
+	PepperVersion int `json:"-"`
+}
+
+// Roles of users
+const (
+	RoleCandidate = "candidate"
+	RoleRecruiter = "recruiter"
+)
+
+// Credentials - the stored password hash of a user together with the version of the pepper it was made with.
+// Roles and MFAEnabled are only filled in when looking up a user by login
+type Credentials struct {
+	PublicID      string
+	Login         string
+	PasswordHash  string
+	PepperVersion int
+	Roles         []string
+	// MFAEnabled tells that signing in takes a second factor after the password
+	MFAEnabled bool
+}
+
+// HasRole - tells whether the user has the role
+func (c *Credentials) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordHistoryEntry - a password hash the user had before
+type PasswordHistoryEntry struct {
+	PasswordHash  string
+	PepperVersion int
+	CreatedAt     time.Time
+}
+
+// ChangePasswordRequest - body of a password change by a signed in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 type RecruiterSignUpRequest struct {
@@ -33,11 +74,86 @@ type CandidateSignUpRequest struct {
 	Skills          []string `json:"skills"`
 }
 
+// Token - a parsed or issued token. AuthTime is when the user last proved who they are and AMR how, see RFC 8176,
+// ACR is the assurance level that follows from AMR
 type Token struct {
+	ID         string
 	PublicID   string
+	SessionID  string
 	TokenValue string
 	Role       string
 	TTL        time.Duration
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	AuthTime   time.Time
+	AMR        []string
+	ACR        string
+}
+
+// Authentication methods carried in the amr claim. They are the values of RFC 8176 except AMREmail, which stands for
+// an emailed sign-in link or code
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMultiFactor = "mfa"
+	AMRHardwareKey = "hwk"
+	AMREmail       = "email"
+)
+
+// Authentication context classes carried in the acr claim, after the authenticator assurance levels of NIST SP 800-63B
+const (
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
+// AuthContextClass - returns the acr of a sign-in with the authentication methods. Passkeys count as multi-factor, since
+// they are only accepted with user verification
+func AuthContextClass(amr []string) string {
+	for _, method := range amr {
+		if method == AMRMultiFactor || method == AMRHardwareKey {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// Token types carried in the token_type claim, so that a refresh token is never accepted as an access token.
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
+// Token transports: where clients send tokens and receive them from
+const (
+	TransportCookie = "cookie"
+	TransportBearer = "bearer"
+	TransportBoth   = "both"
+)
+
+// UsesCookies - tells whether tokens travel in cookies. Cookies are the default transport
+func UsesCookies(transport string) bool {
+	return transport == "" || transport == TransportCookie || transport == TransportBoth
+}
+
+// UsesBearer - tells whether tokens travel in the Authorization header and response bodies
+func UsesBearer(transport string) bool {
+	return transport == TransportBearer || transport == TransportBoth
+}
+
+// SignInResponse - body of a successful sign-in or refresh. Tokens are only included for the bearer transport
+type SignInResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	// PasswordChangeRequired is set on sign-in when the password no longer meets the password policy
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+	// MFARequired is set instead of handing out tokens when the user has to send a second factor along with MFAToken
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	// DeviceToken is handed to bearer transport clients that remembered the device, they send it in the X-Device-Token
+	// header on sign-in
+	DeviceToken string `json:"device_token,omitempty"`
 }
 
 // Tokens - structure for holding access and refresh token
@@ -45,8 +161,188 @@ type Tokens struct {
 	AccessToken  *Token
 	RefreshToken *Token
 }
-type JwtUserClaims struct {
-	PublicID string `json:"user_public_id"`
-	Role     string `json:"role"`
-	jwt.StandardClaims
+
+// ForgotPasswordRequest - asks for a password reset link to be emailed to the user with the login
+type ForgotPasswordRequest struct {
+	Login string `json:"login"`
+}
+
+// ResetPasswordRequest - sets a new password with the token of an emailed reset link
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// MagicLinkRequest - asks for a sign-in link and code to be emailed to the candidate with the login
+type MagicLinkRequest struct {
+	Login string `json:"login"`
+}
+
+// RedeemMagicLinkRequest - signs in with either the token of an emailed link or the login and the emailed code
+type RedeemMagicLinkRequest struct {
+	Token string `json:"token"`
+	Login string `json:"login"`
+	Code  string `json:"code"`
+}
+
+// RetryAfterResponse - tells in how many seconds a blocked sign-in may be retried
+type RetryAfterResponse struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+// UnlockRequest - lifts the lockout of the login after too many failed sign-ins
+type UnlockRequest struct {
+	Login string `json:"login"`
+}
+
+// SignInResult - outcome of a successful sign-in with a password. Users with two-factor sign-in get an MFAToken
+// instead of Tokens, which are only issued once the second factor is verified
+type SignInResult struct {
+	Tokens   *Tokens
+	MFAToken string
+	// DeviceToken is issued when the device was remembered, so that it is not asked for the second factor again
+	DeviceToken string
+	// PasswordChangeRequired tells the client to make the user change a password that was valid when it was set
+	// but does not meet the current password policy
+	PasswordChangeRequired bool
+}
+
+// MFAChallenge - a sign-in with the right password that waits for the second factor. AMR is how the first factor was proven
+type MFAChallenge struct {
+	PublicID               string
+	Login                  string
+	Role                   string
+	AMR                    []string
+	PasswordChangeRequired bool
+}
+
+// ReauthenticateRequest - proves again who the signed in user is with the password and/or a TOTP code or a recovery code.
+// Users with two-factor sign-in have to send a second factor
+type ReauthenticateRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFASignInRequest - completes a sign-in with the MFA token it returned and either a TOTP code or a recovery code.
+// RememberDevice skips the second factor on further sign-ins from the same device for a while
+type MFASignInRequest struct {
+	MFAToken       string `json:"mfa_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	RememberDevice bool   `json:"remember_device"`
+}
+
+// TOTP - the TOTP secret of a user. It is Enabled once the user proved to have set up an authenticator with it,
+// LastUsedStep is the time step of the last accepted code, which cannot be used again
+type TOTP struct {
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// TOTPEnrollment - what an authenticator app is set up with. QRCode is a PNG image of the otpauth URI
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode []byte `json:"qr_code"`
+}
+
+// TOTPCodeRequest - a code of the authenticator app
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse - the one-time recovery codes of a user, only ever shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Passkey - a WebAuthn credential a user signs in with instead of a password. SignCount is the signature counter
+// of the authenticator, a counter that does not increase tells that the passkey was cloned
+type Passkey struct {
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+// PasskeyCeremony - a WebAuthn registration or sign-in waiting for the response of the authenticator. Session is the
+// encoded state of the ceremony, PublicID is only known for registrations and Role only for sign-ins
+type PasskeyCeremony struct {
+	PublicID string
+	Role     string
+	Session  []byte
+}
+
+// Session - a single sign-in of a user on a device. A user may have many sessions at once,
+// each of them is kept alive by its own refresh token. A session is also the family of every refresh token
+// rotated from the one issued at sign-in; only RefreshTokenID, the latest of them, is valid.
+type Session struct {
+	ID             string
+	PublicID       string
+	Role           string
+	RefreshTokenID string
+	CreatedAt      time.Time
+	LastRefreshAt  time.Time
+	UserAgent      string
+	IP             string
+	// AuthTime and AMR describe the authentication the tokens of the session are issued for, see Token
+	AuthTime time.Time
+	AMR      []string
+}
+
+// ClientInfo - describes the device a request came from. DeviceToken is sent by devices the user chose to trust
+type ClientInfo struct {
+	UserAgent   string
+	IP          string
+	DeviceToken string
+}
+
+// TrustedDevice - a device that signs in without the second factor, remembered for the user when a sign-in with
+// the second factor asked for it. It is looked up by the hash of the random device token it was given. SessionID is
+// the session it was remembered in, revoking the session forgets the device
+type TrustedDevice struct {
+	TokenHash string
+	PublicID  string
+	SessionID string
+	CreatedAt time.Time
+	UserAgent string
+	IP        string
+}
+
+// SessionResponse - a session as shown to its owner
+type SessionResponse struct {
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastRefreshAt time.Time `json:"last_refresh_at"`
+	UserAgent     string    `json:"user_agent"`
+	IP            string    `json:"ip"`
+	Current       bool      `json:"current"`
+}
+
+// Token type hints of OAuth 2.0 token introspection (RFC 7662) and revocation (RFC 7009)
+const (
+	AccessTokenHint  = "access_token"
+	RefreshTokenHint = "refresh_token"
+)
+
+// IntrospectionResponse - token introspection response as described in RFC 7662
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+	ACR       string   `json:"acr,omitempty"`
 }
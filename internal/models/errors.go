@@ -1,6 +1,11 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
 	ErrInvalidInput          = errors.New("INVALID_INPUT")
@@ -9,6 +14,61 @@ var (
 	ErrWrongCredential       = errors.New("WRONG_CREDENTIALS")
 	ErrInvalidToken          = errors.New("INVALID_TOKEN")
 	ErrTokenExpired          = errors.New("TOKEN_EXPIRED")
+	ErrTokenReused           = errors.New("TOKEN_REUSED")
 	ErrCompanyDoesntExists   = errors.New("COMPANY_DOES_NOT_EXIST")
 	ErrUsernameExists        = errors.New("USERNAME_EXISTS")
+	ErrSessionNotFound       = errors.New("SESSION_NOT_FOUND")
+	ErrPasswordBreached      = errors.New("PASSWORD_BREACHED")
+	ErrPasswordReused        = errors.New("PASSWORD_REUSED")
+	ErrTooManyAttempts       = errors.New("TOO_MANY_ATTEMPTS")
+	ErrAccountLocked         = errors.New("ACCOUNT_LOCKED")
+	ErrInvalidMFACode        = errors.New("INVALID_MFA_CODE")
+	ErrMFANotEnrolled        = errors.New("MFA_NOT_ENROLLED")
+	ErrMFAAlreadyEnabled     = errors.New("MFA_ALREADY_ENABLED")
+	ErrInvalidPasskey        = errors.New("INVALID_PASSKEY")
+	ErrPasskeyExists         = errors.New("PASSKEY_EXISTS")
+	ErrReauthRequired        = errors.New("REAUTHENTICATION_REQUIRED")
 )
+
+// PolicyViolation - a password policy rule the password does not satisfy. Limit is the configured
+// value of the rule, like the minimum length, and is omitted for rules without one
+type PolicyViolation struct {
+	Rule  string  `json:"rule"`
+	Limit float64 `json:"limit,omitempty"`
+}
+
+// PolicyViolationError - returned when a new password does not meet the password policy.
+// It is an ErrInvalidPasswordFormat that lists every unmet rule
+type PolicyViolationError struct {
+	Violations []*PolicyViolation
+}
+
+func (e *PolicyViolationError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = v.Rule
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidPasswordFormat, strings.Join(rules, ", "))
+}
+
+func (e *PolicyViolationError) Unwrap() error {
+	return ErrInvalidPasswordFormat
+}
+
+// SignInBlockedError - returned when sign-in is refused because of too many failed attempts. It is an ErrAccountLocked
+// when the login is locked out and an ErrTooManyAttempts while failures are backed off
+type SignInBlockedError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *SignInBlockedError) Error() string {
+	return fmt.Sprintf("%v: retry after %v", e.Unwrap(), e.RetryAfter)
+}
+
+func (e *SignInBlockedError) Unwrap() error {
+	if e.Locked {
+		return ErrAccountLocked
+	}
+	return ErrTooManyAttempts
+}
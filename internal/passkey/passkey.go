@@ -0,0 +1,109 @@
+// Package passkey adapts the users and stored passkeys of the service to the WebAuthn ceremonies of go-webauthn.
+package passkey
+
+import (
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// New - returns the relying party from the config. Ceremonies are timed out by the service, which drops their state
+func New(cfg *config.WebAuthnConf) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.Origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		AttestationPreference: protocol.PreferNoAttestation,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Timeout: cfg.Timeout, TimeoutUVD: cfg.Timeout},
+			Registration: webauthn.TimeoutConfig{Timeout: cfg.Timeout, TimeoutUVD: cfg.Timeout},
+		},
+	})
+}
+
+// User - a user as seen by WebAuthn. The user handle stored on authenticators is the public id of the user,
+// which is random and tells nothing about the user
+type User struct {
+	PublicID string
+	Login    string
+	Passkeys []*models.Passkey
+}
+
+func (u *User) WebAuthnID() []byte {
+	return []byte(u.PublicID)
+}
+
+func (u *User) WebAuthnName() string {
+	return u.Login
+}
+
+func (u *User) WebAuthnDisplayName() string {
+	return u.Login
+}
+
+func (u *User) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.Passkeys))
+	for i, p := range u.Passkeys {
+		credentials[i] = Credential(p)
+	}
+	return credentials
+}
+
+// Exclusions - the passkeys the user already has, so that an authenticator is not registered twice
+func (u *User) Exclusions() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, len(u.Passkeys))
+	for i, p := range u.Passkeys {
+		descriptors[i] = Credential(p).Descriptor()
+	}
+	return descriptors
+}
+
+// Credential - converts a stored passkey to a WebAuthn credential
+func Credential(p *models.Passkey) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, len(p.Transports))
+	for i, t := range p.Transports {
+		transports[i] = protocol.AuthenticatorTransport(t)
+	}
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: p.BackupEligible,
+			BackupState:    p.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    p.AAGUID,
+			SignCount: p.SignCount,
+		},
+	}
+}
+
+// FromCredential - converts a newly registered WebAuthn credential to a passkey to store
+func FromCredential(c *webauthn.Credential) *models.Passkey {
+	transports := make([]string, len(c.Transport))
+	for i, t := range c.Transport {
+		transports[i] = string(t)
+	}
+	return &models.Passkey{
+		CredentialID:    c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transports:      transports,
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       c.Authenticator.SignCount,
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+}
@@ -0,0 +1,136 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"golang.org/x/crypto/argon2"
+)
+
+// Defaults follow the second recommended option of RFC 9106 for memory constrained environments.
+const (
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 4
+	defaultArgon2SaltLength  = 16
+	defaultArgon2KeyLength   = 32
+)
+
+var argon2idPrefix = "$" + AlgArgon2id + "$"
+
+// argon2idAlgorithm produces hashes in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type argon2idAlgorithm struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func newArgon2id(cfg *config.Argon2idConf) *argon2idAlgorithm {
+	a := &argon2idAlgorithm{
+		memory:      defaultArgon2Memory,
+		iterations:  defaultArgon2Iterations,
+		parallelism: defaultArgon2Parallelism,
+		saltLength:  defaultArgon2SaltLength,
+		keyLength:   defaultArgon2KeyLength,
+	}
+	if cfg == nil {
+		return a
+	}
+	if cfg.Memory != 0 {
+		a.memory = cfg.Memory
+	}
+	if cfg.Iterations != 0 {
+		a.iterations = cfg.Iterations
+	}
+	if cfg.Parallelism != 0 {
+		a.parallelism = cfg.Parallelism
+	}
+	if cfg.SaltLength != 0 {
+		a.saltLength = cfg.SaltLength
+	}
+	if cfg.KeyLength != 0 {
+		a.keyLength = cfg.KeyLength
+	}
+	return a
+}
+
+func (a *argon2idAlgorithm) Name() string {
+	return AlgArgon2id
+}
+
+func (a *argon2idAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a *argon2idAlgorithm) Hash(password []byte) (string, error) {
+	salt := make([]byte, a.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(password, salt, a.iterations, a.memory, a.parallelism, a.keyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.memory, a.iterations, a.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idAlgorithm) Verify(password []byte, encoded string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	other := argon2.IDKey(password, salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+	outdated := params.memory != a.memory ||
+		params.iterations != a.iterations ||
+		params.parallelism != a.parallelism ||
+		uint32(len(salt)) != a.saltLength ||
+		uint32(len(key)) != a.keyLength
+	return true, outdated, nil
+}
+
+func decodeArgon2id(encoded string) (*argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownHash)
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: malformed argon2id version: %v", ErrUnknownHash, err)
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("%w: unsupported argon2id version %d", ErrUnknownHash, version)
+	}
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: malformed argon2id parameters: %v", ErrUnknownHash, err)
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnknownHash)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: malformed argon2id salt: %v", ErrUnknownHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: malformed argon2id key", ErrUnknownHash)
+	}
+	return params, salt, key, nil
+}
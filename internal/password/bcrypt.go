@@ -0,0 +1,56 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultBcryptCost = 12
+
+// bcryptAlgorithm verifies the hashes created before argon2id became the default and can still be configured
+// to hash new passwords. bcrypt only uses the first 72 bytes of a password.
+type bcryptAlgorithm struct {
+	cost int
+}
+
+func newBcrypt(cfg *config.BcryptConf) *bcryptAlgorithm {
+	b := &bcryptAlgorithm{cost: defaultBcryptCost}
+	if cfg != nil && cfg.Cost != 0 {
+		b.cost = cfg.Cost
+	}
+	return b
+}
+
+func (b *bcryptAlgorithm) Name() string {
+	return AlgBcrypt
+}
+
+func (b *bcryptAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b *bcryptAlgorithm) Hash(password []byte) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(password, b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *bcryptAlgorithm) Verify(password []byte, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost != b.cost, nil
+}
@@ -0,0 +1,119 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"go.uber.org/zap"
+)
+
+const sha1HexLength = sha1.Size * 2
+
+// BreachList tells whether a password is known from public data breaches.
+type BreachList interface {
+	Contains(password string) (bool, error)
+	Close() error
+}
+
+// hashList is a Have I Been Pwned style list of upper case SHA-1 password hashes, one "<hash>:<count>" per line,
+// sorted by hash. It is mapped into memory where possible and binary searched, so no network calls are made.
+type hashList struct {
+	data     []byte
+	minCount int
+	unmap    func() error
+}
+
+// noBreachList is used when no list is configured and knows no passwords.
+type noBreachList struct{}
+
+// OpenBreachList - opens the list configured in cfg. Without a path every password is considered not breached.
+func OpenBreachList(cfg *config.BreachedConf, logger *zap.SugaredLogger) (BreachList, error) {
+	if cfg == nil || cfg.Path == "" {
+		logger.Warn("breached password list is not configured, passwords are not checked against breaches")
+		return noBreachList{}, nil
+	}
+	data, unmap, err := mapFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open breached password list: %w", err)
+	}
+	if len(data) > 0 && len(data) < sha1HexLength {
+		_ = unmap()
+		return nil, fmt.Errorf("breached password list %s is not a list of SHA-1 hashes", cfg.Path)
+	}
+	minCount := cfg.MinCount
+	if minCount < 1 {
+		minCount = 1
+	}
+	logger.Infof("loaded breached password list %s of %d bytes", cfg.Path, len(data))
+	return &hashList{data: data, minCount: minCount, unmap: unmap}, nil
+}
+
+// Contains reports whether the password is on the list and was seen in breaches at least min_count times.
+func (l *hashList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := make([]byte, sha1HexLength)
+	hex.Encode(target, sum[:])
+	target = bytes.ToUpper(target)
+
+	// lo and hi are always at the start of a line, so every step looks at the line around the middle
+	lo, hi := 0, len(l.data)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start := bytes.LastIndexByte(l.data[lo:mid], '\n') + 1 + lo
+		end := bytes.IndexByte(l.data[start:hi], '\n')
+		if end < 0 {
+			end = hi
+		} else {
+			end += start
+		}
+		line := bytes.TrimRight(l.data[start:end], "\r")
+		hash := line
+		if len(hash) > sha1HexLength {
+			hash = hash[:sha1HexLength]
+		}
+		switch cmp := bytes.Compare(hash, target); {
+		case cmp < 0:
+			lo = end + 1
+		case cmp > 0:
+			hi = start
+		default:
+			count, err := lineCount(line)
+			if err != nil {
+				return false, err
+			}
+			return count >= l.minCount, nil
+		}
+	}
+	return false, nil
+}
+
+func (l *hashList) Close() error {
+	return l.unmap()
+}
+
+// lineCount - returns the number of breaches of a "<hash>:<count>" line, lines without a count are counted once
+func lineCount(line []byte) (int, error) {
+	if len(line) == sha1HexLength {
+		return 1, nil
+	}
+	if line[sha1HexLength] != ':' {
+		return 0, fmt.Errorf("malformed line in breached password list: %q", line)
+	}
+	count, err := strconv.Atoi(string(line[sha1HexLength+1:]))
+	if err != nil {
+		return 0, fmt.Errorf("malformed count in breached password list: %q", line)
+	}
+	return count, nil
+}
+
+func (noBreachList) Contains(string) (bool, error) {
+	return false, nil
+}
+
+func (noBreachList) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package password
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+)
+
+// Names of the supported hashing algorithms.
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Algorithm is a password hashing scheme. Every algorithm encodes its hashes in a self-describing
+// format, so hashes made by different algorithms or with different parameters can live side by side.
+type Algorithm interface {
+	Name() string
+	// Hash hashes the password with a random salt and the current parameters.
+	Hash(password []byte) (string, error)
+	// Identifies reports whether the encoded hash was made by this algorithm.
+	Identifies(encoded string) bool
+	// Verify reports whether the password matches the encoded hash and whether the hash
+	// was made with parameters other than the current ones.
+	Verify(password []byte, encoded string) (match bool, outdated bool, err error)
+}
+
+// Hasher hashes new passwords with the configured algorithm and pepper, and verifies hashes of every
+// known algorithm and pepper version. The pepper version is not part of the hash and is stored next to it.
+type Hasher struct {
+	current       Algorithm
+	algorithms    []Algorithm
+	peppers       map[int][]byte
+	pepperVersion int
+	// dummy is a hash of a random password made like any new hash, see VerifyDummy
+	dummy string
+}
+
+func New(cfg *config.PasswordConf) (*Hasher, error) {
+	if cfg == nil {
+		cfg = &config.PasswordConf{}
+	}
+	algorithms := []Algorithm{newArgon2id(cfg.Argon2id), newBcrypt(cfg.Bcrypt)}
+	peppers, pepperVersion, err := loadPeppers(cfg.Pepper)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Algorithm
+	if name == "" {
+		name = AlgArgon2id
+	}
+	for _, alg := range algorithms {
+		if alg.Name() == name {
+			h := &Hasher{current: alg, algorithms: algorithms, peppers: peppers, pepperVersion: pepperVersion}
+			random := make([]byte, 32)
+			if _, err := rand.Read(random); err != nil {
+				return nil, err
+			}
+			if h.dummy, _, err = h.Hash(string(random)); err != nil {
+				return nil, err
+			}
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported password hashing algorithm %q", name)
+}
+
+// Hash hashes the password with the configured algorithm and pepper. It returns the pepper version that must be
+// stored along with the hash.
+func (h *Hasher) Hash(password string) (string, int, error) {
+	peppered, err := h.pepper(password, h.pepperVersion)
+	if err != nil {
+		return "", 0, err
+	}
+	encoded, err := h.current.Hash(peppered)
+	if err != nil {
+		return "", 0, err
+	}
+	return encoded, h.pepperVersion, nil
+}
+
+// Verify checks the password against a hash made by any supported algorithm with the pepper of pepperVersion.
+// needsRehash is set when the password matched but the hash was made by another algorithm, with outdated
+// parameters or with another pepper, so the caller should store a fresh hash while it knows the plain password.
+func (h *Hasher) Verify(password, encoded string, pepperVersion int) (match bool, needsRehash bool, err error) {
+	for _, alg := range h.algorithms {
+		if !alg.Identifies(encoded) {
+			continue
+		}
+		peppered, err := h.pepper(password, pepperVersion)
+		if err != nil {
+			return false, false, err
+		}
+		match, outdated, err := alg.Verify(peppered, encoded)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, outdated || alg != h.current || pepperVersion != h.pepperVersion, nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+// VerifyDummy takes as long as verifying a password against a new hash but never matches. It is meant for sign-ins of
+// unknown users, so that response times do not tell which users exist.
+func (h *Hasher) VerifyDummy(password string) {
+	_, _, _ = h.Verify(password, h.dummy, h.pepperVersion)
+}
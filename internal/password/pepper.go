@@ -0,0 +1,67 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+)
+
+// NoPepper is the version of hashes made from the plain password.
+const NoPepper = 0
+
+const minPepperLength = 32
+
+var ErrUnknownPepper = errors.New("unknown pepper version")
+
+// loadPeppers reads the pepper keys of every configured version.
+func loadPeppers(cfg *config.PepperConf) (map[int][]byte, int, error) {
+	peppers := map[int][]byte{}
+	if cfg == nil {
+		return peppers, NoPepper, nil
+	}
+	for _, kc := range cfg.Keys {
+		if kc.Version <= NoPepper {
+			return nil, 0, fmt.Errorf("pepper version must be positive, got %d", kc.Version)
+		}
+		if _, ok := peppers[kc.Version]; ok {
+			return nil, 0, fmt.Errorf("duplicate pepper version %d", kc.Version)
+		}
+		key, err := os.ReadFile(kc.Path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read pepper version %d: %w", kc.Version, err)
+		}
+		if len(key) < minPepperLength {
+			return nil, 0, fmt.Errorf("pepper version %d is shorter than %d bytes", kc.Version, minPepperLength)
+		}
+		peppers[kc.Version] = key
+	}
+	if cfg.Current != NoPepper {
+		if _, ok := peppers[cfg.Current]; !ok {
+			return nil, 0, fmt.Errorf("current pepper version %d is not configured", cfg.Current)
+		}
+	}
+	return peppers, cfg.Current, nil
+}
+
+// pepper keys the password with the pepper of the version. The MAC is base64 encoded so that it
+// has no NUL bytes and fits into the 72 bytes bcrypt looks at.
+func (h *Hasher) pepper(password string, version int) ([]byte, error) {
+	if version == NoPepper {
+		return []byte(password), nil
+	}
+	key, ok := h.peppers[version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownPepper, version)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	sum := mac.Sum(nil)
+	encoded := make([]byte, base64.RawStdEncoding.EncodedLen(len(sum)))
+	base64.RawStdEncoding.Encode(encoded, sum)
+	return encoded, nil
+}
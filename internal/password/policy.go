@@ -0,0 +1,189 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+// Names of the policy rules reported to clients.
+const (
+	RuleMinLength       = "min_length"
+	RuleMaxLength       = "max_length"
+	RuleUpper           = "uppercase"
+	RuleLower           = "lowercase"
+	RuleNumber          = "number"
+	RuleSpecial         = "special"
+	RuleUserInfo        = "user_info"
+	RuleRepeatedChars   = "repeated_chars"
+	RuleSequentialChars = "sequential_chars"
+	RuleEntropy         = "entropy"
+)
+
+// minUserInfoLength - shorter logins and names are not looked for in passwords, they would match by accident
+const minUserInfoLength = 3
+
+// Sizes of the character pools used to estimate entropy.
+const (
+	lowerPool   = 26
+	upperPool   = 26
+	numberPool  = 10
+	specialPool = 33
+	otherPool   = 100
+)
+
+// Policy checks new passwords against the configured rules.
+type Policy struct {
+	cfg *config.PolicyConf
+}
+
+// NewPolicy - without configuration the policy requires upper and lower case characters, a number and a special character
+func NewPolicy(cfg *config.PolicyConf) *Policy {
+	if cfg == nil {
+		cfg = &config.PolicyConf{
+			RequireUpper:   true,
+			RequireLower:   true,
+			RequireNumber:  true,
+			RequireSpecial: true,
+		}
+	}
+	return &Policy{cfg: cfg}
+}
+
+// Check returns every rule the password does not satisfy, or nil if it meets the policy.
+// userInfo are the login and names of the user, which the password must not contain.
+func (p *Policy) Check(password string, userInfo ...string) []*models.PolicyViolation {
+	var violations []*models.PolicyViolation
+	violate := func(rule string, limit float64) {
+		violations = append(violations, &models.PolicyViolation{Rule: rule, Limit: limit})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.cfg.MinLength > 0 && length < p.cfg.MinLength {
+		violate(RuleMinLength, float64(p.cfg.MinLength))
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		violate(RuleMaxLength, float64(p.cfg.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasNumber, hasSpecial, hasOther bool
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsNumber(char):
+			hasNumber = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char):
+			hasSpecial = true
+		default:
+			hasOther = true
+		}
+	}
+	if p.cfg.RequireUpper && !hasUpper {
+		violate(RuleUpper, 0)
+	}
+	if p.cfg.RequireLower && !hasLower {
+		violate(RuleLower, 0)
+	}
+	if p.cfg.RequireNumber && !hasNumber {
+		violate(RuleNumber, 0)
+	}
+	if p.cfg.RequireSpecial && !hasSpecial {
+		violate(RuleSpecial, 0)
+	}
+
+	if p.cfg.ForbidUserInfo && containsUserInfo(password, userInfo) {
+		violate(RuleUserInfo, 0)
+	}
+
+	repeated, sequential := longestRuns(password)
+	if p.cfg.MaxRepeatedChars > 0 && repeated > p.cfg.MaxRepeatedChars {
+		violate(RuleRepeatedChars, float64(p.cfg.MaxRepeatedChars))
+	}
+	if p.cfg.MaxSequentialChars > 0 && sequential > p.cfg.MaxSequentialChars {
+		violate(RuleSequentialChars, float64(p.cfg.MaxSequentialChars))
+	}
+
+	if p.cfg.MinEntropy > 0 {
+		pool := 0
+		for _, class := range []struct {
+			present bool
+			size    int
+		}{{hasLower, lowerPool}, {hasUpper, upperPool}, {hasNumber, numberPool}, {hasSpecial, specialPool}, {hasOther, otherPool}} {
+			if class.present {
+				pool += class.size
+			}
+		}
+		if entropy(length, pool) < p.cfg.MinEntropy {
+			violate(RuleEntropy, p.cfg.MinEntropy)
+		}
+	}
+	return violations
+}
+
+// entropy - estimates the strength of a password in bits as if its characters were picked at random from the pool
+func entropy(length, pool int) float64 {
+	if length == 0 || pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(pool))
+}
+
+func containsUserInfo(password string, userInfo []string) bool {
+	lower := strings.ToLower(password)
+	for _, info := range userInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if utf8.RuneCountInString(info) < minUserInfoLength {
+			continue
+		}
+		if strings.Contains(lower, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestRuns - returns the length of the longest run of the same character and of the longest run of
+// consecutive characters in either direction, like "abcd" or "4321". Letters are compared case insensitively.
+func longestRuns(password string) (int, int) {
+	var (
+		repeated, sequential int
+		sameRun, seqRun      int
+		step                 rune
+		prev                 rune = -1
+	)
+	for _, char := range password {
+		char = unicode.ToLower(char)
+		diff := char - prev
+		switch {
+		case prev == -1:
+			sameRun, seqRun = 1, 1
+		case diff == 0:
+			sameRun++
+			seqRun = 1
+		case (diff == 1 || diff == -1) && diff == step && seqRun > 1:
+			sameRun = 1
+			seqRun++
+		case diff == 1 || diff == -1:
+			sameRun = 1
+			seqRun = 2
+		default:
+			sameRun, seqRun = 1, 1
+		}
+		step = diff
+		prev = char
+		if sameRun > repeated {
+			repeated = sameRun
+		}
+		if seqRun > sequential {
+			sequential = seqRun
+		}
+	}
+	return repeated, sequential
+}
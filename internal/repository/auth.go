@@ -27,24 +27,180 @@ func NewAuthRepository(db *pgxpool.Pool, cfg *config.DBConf, logger *zap.Sugared
 	}
 }
 
-func (r *authRepository) GetUserInfoByLogin(login string) (string, string, error) {
+// GetUserInfoByLogin - returns the credentials of the user with the login, the roles of the user and whether two-factor
+// sign-in is enabled, all in a single query so that signing in takes the same time whatever the role
+func (r *authRepository) GetUserInfoByLogin(login string) (*models.Credentials, error) {
 	var password string
+	var pepperVersion int
+	var isCandidate, isRecruiter, mfaEnabled bool
 	var ID uuid.UUID
 	timeout := r.cfg.TimeOut
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	query := `SELECT u.public_id, a.password
+	query := `SELECT u.public_id, a.password, a.pepper_version,
+		EXISTS(SELECT 1 FROM candidates WHERE public_id = u.public_id),
+		EXISTS(SELECT 1 FROM recruiters WHERE public_id = u.public_id),
+		EXISTS(SELECT 1 FROM totp_secrets WHERE user_id = u.id AND enabled)
 	FROM users as u
 	JOIN auth as a ON u.id = a.user_id
 	WHERE a.login= $1`
-	if err := r.db.QueryRow(ctx, query, login).Scan(&ID, &password); err != nil {
+	if err := r.db.QueryRow(ctx, query, login).Scan(&ID, &password, &pepperVersion, &isCandidate, &isRecruiter, &mfaEnabled); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", "", fmt.Errorf("%w: error occurred while getting password_hash from db: auth does not exist", models.ErrWrongCredential)
+			return nil, fmt.Errorf("%w: error occurred while getting password_hash from db: auth does not exist", models.ErrWrongCredential)
 		}
-		return "", "", fmt.Errorf("%w: error occurred while getting password_hash from db: %v", models.ErrInternalServer, err)
+		return nil, fmt.Errorf("%w: error occurred while getting password_hash from db: %v", models.ErrInternalServer, err)
 	}
-	return password, ID.String(), nil
+	creds := &models.Credentials{
+		PublicID:      ID.String(),
+		Login:         login,
+		PasswordHash:  password,
+		PepperVersion: pepperVersion,
+		MFAEnabled:    mfaEnabled,
+	}
+	if isCandidate {
+		creds.Roles = append(creds.Roles, models.RoleCandidate)
+	}
+	if isRecruiter {
+		creds.Roles = append(creds.Roles, models.RoleRecruiter)
+	}
+	return creds, nil
+
+}
+
+// GetCredentials - returns the login and password hash of the user with the given public id
+func (r *authRepository) GetCredentials(publicID string) (*models.Credentials, error) {
+	creds := &models.Credentials{PublicID: publicID}
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `SELECT a.login, a.password, a.pepper_version
+	FROM users as u
+	JOIN auth as a ON u.id = a.user_id
+	WHERE u.public_id = $1`
+	if err := r.db.QueryRow(ctx, query, publicID).Scan(&creds.Login, &creds.PasswordHash, &creds.PepperVersion); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: error occurred while getting password_hash from db: auth of user %s does not exist", models.ErrWrongCredential, publicID)
+		}
+		return nil, fmt.Errorf("%w: error occurred while getting password_hash from db: %v", models.ErrInternalServer, err)
+	}
+	return creds, nil
+}
+
+// GetEmailByLogin - returns the public id and the email address of the user with the given login
+func (r *authRepository) GetEmailByLogin(login string) (string, string, error) {
+	var email *string
+	var ID uuid.UUID
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `SELECT u.public_id, u.email
+	FROM users as u
+	JOIN auth as a ON u.id = a.user_id
+	WHERE a.login = $1`
+	if err := r.db.QueryRow(ctx, query, login).Scan(&ID, &email); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", fmt.Errorf("%w: error occurred while getting email from db: auth does not exist", models.ErrWrongCredential)
+		}
+		return "", "", fmt.Errorf("%w: error occurred while getting email from db: %v", models.ErrInternalServer, err)
+	}
+	if email == nil {
+		return ID.String(), "", nil
+	}
+	return ID.String(), *email, nil
+}
+
+// UpdatePassword - replaces the password hash of the user with the given public id and the version of its pepper
+func (r *authRepository) UpdatePassword(publicID, passwordHash string, pepperVersion int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `UPDATE auth
+	SET password = $1, pepper_version = $2
+	WHERE user_id = (SELECT id FROM users WHERE public_id = $3)`
+	tag, err := r.db.Exec(ctx, query, passwordHash, pepperVersion, publicID)
+	if err != nil {
+		return fmt.Errorf("%w: error occurred while updating password_hash in db: %v", models.ErrInternalServer, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: error occurred while updating password_hash in db: auth of user %s does not exist", models.ErrInternalServer, publicID)
+	}
+	return nil
+}
 
+// ChangePassword - replaces the password hash of the user and moves the replaced one to the password history.
+// Only the historySize most recent previous hashes are kept
+func (r *authRepository) ChangePassword(publicID, passwordHash string, pepperVersion int, historySize int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: error occurred while changing password: %v", models.ErrInternalServer, err)
+	}
+	rollback := func(err error) error {
+		if errTX := tx.Rollback(ctx); errTX != nil {
+			r.logger.Errorf("ERROR: transaction: %s", errTX)
+		}
+		return fmt.Errorf("%w: error occurred while changing password: %v", models.ErrInternalServer, err)
+	}
+
+	var userID int64
+	query := `INSERT INTO password_history (user_id, password, pepper_version)
+	SELECT a.user_id, a.password, a.pepper_version
+	FROM auth as a
+	JOIN users as u ON u.id = a.user_id
+	WHERE u.public_id = $1
+	RETURNING user_id`
+	if err := tx.QueryRow(ctx, query, publicID).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = fmt.Errorf("auth of user %s does not exist", publicID)
+		}
+		return rollback(err)
+	}
+
+	query = `UPDATE auth SET password = $1, pepper_version = $2 WHERE user_id = $3`
+	if _, err := tx.Exec(ctx, query, passwordHash, pepperVersion, userID); err != nil {
+		return rollback(err)
+	}
+
+	query = `DELETE FROM password_history
+	WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2
+	)`
+	if _, err := tx.Exec(ctx, query, userID, historySize); err != nil {
+		return rollback(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return rollback(err)
+	}
+	return nil
+}
+
+// GetPasswordHistory - returns up to limit previous password hashes of the user, the most recent first
+func (r *authRepository) GetPasswordHistory(publicID string, limit int) ([]*models.PasswordHistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `SELECT h.password, h.pepper_version, h.created_at
+	FROM password_history as h
+	JOIN users as u ON u.id = h.user_id
+	WHERE u.public_id = $1
+	ORDER BY h.created_at DESC, h.id DESC
+	LIMIT $2`
+	rows, err := r.db.Query(ctx, query, publicID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error occurred while getting password history from db: %v", models.ErrInternalServer, err)
+	}
+	defer rows.Close()
+
+	history := []*models.PasswordHistoryEntry{}
+	for rows.Next() {
+		entry := &models.PasswordHistoryEntry{}
+		if err := rows.Scan(&entry.PasswordHash, &entry.PepperVersion, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%w: error occurred while getting password history from db: %v", models.ErrInternalServer, err)
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: error occurred while getting password history from db: %v", models.ErrInternalServer, err)
+	}
+	return history, nil
 }
 
 func (r *authRepository) Exists(login string) (bool, error) {
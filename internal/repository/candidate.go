@@ -105,9 +105,9 @@ func (r *candidateRepository) CreateCandidate(candidate *models.CandidateSignUpR
 		}
 	}
 
-	query = `INSERT INTO auth (user_id, login, password) VALUES ($1, $2, $3);`
+	query = `INSERT INTO auth (user_id, login, password, pepper_version) VALUES ($1, $2, $3, $4);`
 
-	_, err = tx.Exec(ctx, query, user_id, candidate.Login, candidate.Password)
+	_, err = tx.Exec(ctx, query, user_id, candidate.Login, candidate.Password, candidate.PepperVersion)
 	if err != nil {
 		r.logger.Errorf("Error occurred while creating authentication info: %v", err)
 		return err
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+type ceremonyRepository struct {
+	client *redis.Client
+}
+
+func NewCeremonyRepository(client *redis.Client) CeremonyRepository {
+	return &ceremonyRepository{
+		client: client,
+	}
+}
+
+// Ceremonies are stored by their challenge, which the authenticator signs and the client sends back with its response.
+func ceremonyKey(challenge string) string {
+	return "webauthn_ceremony:" + challenge
+}
+
+func (r *ceremonyRepository) CreateCeremony(challenge string, ceremony *models.PasskeyCeremony, ttl time.Duration) error {
+	key := ceremonyKey(challenge)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, map[string]interface{}{
+			"public_id": ceremony.PublicID,
+			"role":      ceremony.Role,
+			"session":   ceremony.Session,
+		})
+		pipe.PExpire(key, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w could not store WebAuthn ceremony: %v", models.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// TakeCeremony - returns the ceremony and deletes it, so that every challenge is answered at most once
+func (r *ceremonyRepository) TakeCeremony(challenge string) (*models.PasskeyCeremony, error) {
+	key := ceremonyKey(challenge)
+	var get *redis.StringStringMapCmd
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w could not retrieve WebAuthn ceremony from redis: %v", models.ErrInternalServer, err)
+	}
+	fields := get.Val()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("WebAuthn ceremony does not exist in storage: %w", models.ErrInvalidPasskey)
+	}
+	return &models.PasskeyCeremony{
+		PublicID: fields["public_id"],
+		Role:     fields["role"],
+		Session:  []byte(fields["session"]),
+	}, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+type challengeRepository struct {
+	client *redis.Client
+}
+
+func NewChallengeRepository(client *redis.Client) ChallengeRepository {
+	return &challengeRepository{
+		client: client,
+	}
+}
+
+// failChallengeScript counts a wrong second factor and drops the challenge once ARGV[1] were sent.
+// It returns 1 if the challenge was dropped.
+var failChallengeScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+return 0
+`)
+
+func challengeKey(tokenHash string) string {
+	return "mfa_challenge:" + tokenHash
+}
+
+func (r *challengeRepository) CreateChallenge(tokenHash string, challenge *models.MFAChallenge, ttl time.Duration) error {
+	key := challengeKey(tokenHash)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, map[string]interface{}{
+			"public_id":                challenge.PublicID,
+			"login":                    challenge.Login,
+			"role":                     challenge.Role,
+			"amr":                      strings.Join(challenge.AMR, " "),
+			"password_change_required": strconv.FormatBool(challenge.PasswordChangeRequired),
+			"attempts":                 0,
+		})
+		pipe.PExpire(key, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w could not store MFA challenge of user %s: %v", models.ErrInternalServer, challenge.PublicID, err)
+	}
+	return nil
+}
+
+func (r *challengeRepository) GetChallenge(tokenHash string) (*models.MFAChallenge, error) {
+	fields, err := r.client.HGetAll(challengeKey(tokenHash)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w could not retrieve MFA challenge from redis: %v", models.ErrInternalServer, err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("MFA challenge does not exist in storage: %w", models.ErrInvalidToken)
+	}
+	changeRequired, _ := strconv.ParseBool(fields["password_change_required"])
+	return &models.MFAChallenge{
+		PublicID:               fields["public_id"],
+		Login:                  fields["login"],
+		Role:                   fields["role"],
+		AMR:                    strings.Fields(fields["amr"]),
+		PasswordChangeRequired: changeRequired,
+	}, nil
+}
+
+func (r *challengeRepository) FailChallenge(tokenHash string, maxAttempts int) (bool, error) {
+	res, err := failChallengeScript.Run(r.client, []string{challengeKey(tokenHash)}, maxAttempts).Int()
+	if err != nil {
+		return false, fmt.Errorf("%w could not count failed MFA attempt: %v", models.ErrInternalServer, err)
+	}
+	return res == 1, nil
+}
+
+func (r *challengeRepository) DeleteChallenge(tokenHash string) error {
+	deleted, err := r.client.Del(challengeKey(tokenHash)).Result()
+	if err != nil {
+		return fmt.Errorf("%w could not delete MFA challenge: %v", models.ErrInternalServer, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("MFA challenge was already used: %w", models.ErrInvalidToken)
+	}
+	return nil
+}
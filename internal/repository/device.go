@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+type deviceRepository struct {
+	client *redis.Client
+}
+
+func NewDeviceRepository(client *redis.Client) DeviceRepository {
+	return &deviceRepository{
+		client: client,
+	}
+}
+
+// deleteDevicesScript forgets the trusted devices of a user that were remembered in the session ARGV[2], or all of them
+// if it is empty. Devices that expired on their own are dropped from the set of the user on the way.
+var deleteDevicesScript = redis.NewScript(`
+local hashes = redis.call('SMEMBERS', KEYS[1])
+for _, hash in ipairs(hashes) do
+	local sessionID = redis.call('HGET', ARGV[1] .. hash, 'session_id')
+	if not sessionID or ARGV[2] == '' or sessionID == ARGV[2] then
+		redis.call('DEL', ARGV[1] .. hash)
+		redis.call('SREM', KEYS[1], hash)
+	end
+end
+return 1
+`)
+
+func deviceKey(tokenHash string) string {
+	return "trusted_device:" + tokenHash
+}
+
+func userDevicesKey(publicID string) string {
+	return "user_trusted_devices:" + publicID
+}
+
+func (r *deviceRepository) CreateDevice(device *models.TrustedDevice, ttl time.Duration) error {
+	key := deviceKey(device.TokenHash)
+	setKey := userDevicesKey(device.PublicID)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, map[string]interface{}{
+			"public_id":  device.PublicID,
+			"session_id": device.SessionID,
+			"created_at": device.CreatedAt.Unix(),
+			"user_agent": device.UserAgent,
+			"ip":         device.IP,
+		})
+		pipe.Expire(key, ttl)
+		pipe.SAdd(setKey, device.TokenHash)
+		pipe.Expire(setKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w could not store trusted device of user %s: %v", models.ErrInternalServer, device.PublicID, err)
+	}
+	return nil
+}
+
+func (r *deviceRepository) IsTrustedDevice(publicID, tokenHash string) (bool, error) {
+	owner, err := r.client.HGet(deviceKey(tokenHash), "public_id").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w could not retrieve trusted device of user %s from redis: %v", models.ErrInternalServer, publicID, err)
+	}
+	return owner == publicID, nil
+}
+
+func (r *deviceRepository) DeleteDevices(publicID, sessionID string) error {
+	err := deleteDevicesScript.Run(r.client, []string{userDevicesKey(publicID)}, deviceKey(""), sessionID).Err()
+	if err != nil {
+		return fmt.Errorf("%w could not delete trusted devices of user %s: %v", models.ErrInternalServer, publicID, err)
+	}
+	return nil
+}
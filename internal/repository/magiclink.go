@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+type magicLinkRepository struct {
+	client *redis.Client
+}
+
+func NewMagicLinkRepository(client *redis.Client) MagicLinkRepository {
+	return &magicLinkRepository{
+		client: client,
+	}
+}
+
+// createMagicLinkScript stores the link token and code of a login and drops the previous ones, so only the latest email works.
+var createMagicLinkScript = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[2], 'token_hash')
+if previous then
+	redis.call('DEL', ARGV[4] .. previous)
+end
+redis.call('DEL', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[5])
+redis.call('HSET', KEYS[2], 'token_hash', ARGV[2], 'code_hash', ARGV[3], 'attempts', 0)
+redis.call('PEXPIRE', KEYS[2], ARGV[5])
+return 1
+`)
+
+// redeemMagicLinkScript uses up the link token together with the code emailed along. It returns the login or false.
+var redeemMagicLinkScript = redis.NewScript(`
+local login = redis.call('GET', KEYS[1])
+if not login then
+	return false
+end
+redis.call('DEL', KEYS[1])
+redis.call('DEL', ARGV[1] .. login)
+return login
+`)
+
+// redeemMagicCodeScript uses up the code of a login together with the link emailed along. A wrong code is counted and
+// drops both after ARGV[3] attempts. It returns -1 if there is no code, 0 if it is wrong and 1 if it was used up.
+var redeemMagicCodeScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'token_hash', 'code_hash')
+if not fields[1] then
+	return -1
+end
+if fields[2] == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	redis.call('DEL', ARGV[2] .. fields[1])
+	return 1
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) >= tonumber(ARGV[3]) then
+	redis.call('DEL', KEYS[1])
+	redis.call('DEL', ARGV[2] .. fields[1])
+end
+return 0
+`)
+
+func magicLinkKey(tokenHash string) string {
+	return "magic_link:" + tokenHash
+}
+
+func loginMagicLinkKey(login string) string {
+	return "login_magic_link:" + login
+}
+
+func (r *magicLinkRepository) CreateMagicLink(login, tokenHash, codeHash string, ttl time.Duration) error {
+	keys := []string{magicLinkKey(tokenHash), loginMagicLinkKey(login)}
+	err := createMagicLinkScript.Run(r.client, keys, login, tokenHash, codeHash, magicLinkKey(""), ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("%w could not store magic link of login %s: %v", models.ErrInternalServer, login, err)
+	}
+	return nil
+}
+
+func (r *magicLinkRepository) RedeemMagicLink(tokenHash string) (string, error) {
+	login, err := redeemMagicLinkScript.Run(r.client, []string{magicLinkKey(tokenHash)}, loginMagicLinkKey("")).Text()
+	if err == redis.Nil {
+		return "", fmt.Errorf("magic link does not exist in storage: %w", models.ErrInvalidToken)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w could not redeem magic link: %v", models.ErrInternalServer, err)
+	}
+	return login, nil
+}
+
+func (r *magicLinkRepository) RedeemMagicCode(login, codeHash string, maxAttempts int) error {
+	res, err := redeemMagicCodeScript.Run(r.client, []string{loginMagicLinkKey(login)}, codeHash, magicLinkKey(""), maxAttempts).Int()
+	if err != nil {
+		return fmt.Errorf("%w could not redeem magic code of login %s: %v", models.ErrInternalServer, login, err)
+	}
+	switch res {
+	case -1:
+		return fmt.Errorf("magic code of login %s does not exist in storage: %w", login, models.ErrWrongCredential)
+	case 0:
+		return fmt.Errorf("magic code of login %s is wrong: %w", login, models.ErrWrongCredential)
+	}
+	return nil
+}
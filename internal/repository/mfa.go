@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+type mfaRepository struct {
+	db     *pgxpool.Pool
+	cfg    *config.DBConf
+	logger *zap.SugaredLogger
+}
+
+func NewMFARepository(db *pgxpool.Pool, cfg *config.DBConf, logger *zap.SugaredLogger) MFARepository {
+	return &mfaRepository{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// CreateTOTP - stores a new TOTP secret of the user that is not enabled yet, replacing one from an unfinished enrollment
+func (r *mfaRepository) CreateTOTP(publicID, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `INSERT INTO totp_secrets (user_id, secret)
+	SELECT id, $2 FROM users WHERE public_id = $1
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+	WHERE NOT totp_secrets.enabled`
+	res, err := r.db.Exec(ctx, query, publicID, secret)
+	if err != nil {
+		return fmt.Errorf("%w: error occurred while storing TOTP secret: %v", models.ErrInternalServer, err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("TOTP of user %s: %w", publicID, models.ErrMFAAlreadyEnabled)
+	}
+	return nil
+}
+
+func (r *mfaRepository) GetTOTP(publicID string) (*models.TOTP, error) {
+	totp := &models.TOTP{}
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `SELECT t.secret, t.enabled, t.last_used_step
+	FROM totp_secrets as t
+	JOIN users as u ON u.id = t.user_id
+	WHERE u.public_id = $1`
+	if err := r.db.QueryRow(ctx, query, publicID).Scan(&totp.Secret, &totp.Enabled, &totp.LastUsedStep); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("TOTP of user %s: %w", publicID, models.ErrMFANotEnrolled)
+		}
+		return nil, fmt.Errorf("%w: error occurred while getting TOTP secret from db: %v", models.ErrInternalServer, err)
+	}
+	return totp, nil
+}
+
+// EnableTOTP - enables two-factor sign-in of the user with the code of the given time step, which cannot be used again.
+// The recovery codes replace any the user had before
+func (r *mfaRepository) EnableTOTP(publicID string, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("%w: error occurred while enabling TOTP: %v", models.ErrInternalServer, err)
+	}
+	rollback := func(err error) error {
+		if errTX := tx.Rollback(ctx); errTX != nil {
+			r.logger.Errorf("ERROR: transaction: %s", errTX)
+		}
+		return err
+	}
+
+	var userID int64
+	query := `UPDATE totp_secrets SET enabled = TRUE, last_used_step = $2
+	WHERE user_id = (SELECT id FROM users WHERE public_id = $1) AND NOT enabled
+	RETURNING user_id`
+	if err := tx.QueryRow(ctx, query, publicID, step).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return rollback(fmt.Errorf("TOTP of user %s: %w", publicID, models.ErrMFAAlreadyEnabled))
+		}
+		return rollback(fmt.Errorf("%w: error occurred while enabling TOTP: %v", models.ErrInternalServer, err))
+	}
+
+	query = `DELETE FROM recovery_codes WHERE user_id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return rollback(fmt.Errorf("%w: error occurred while enabling TOTP: %v", models.ErrInternalServer, err))
+	}
+
+	query = `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, query, userID, hash); err != nil {
+			return rollback(fmt.Errorf("%w: error occurred while enabling TOTP: %v", models.ErrInternalServer, err))
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return rollback(fmt.Errorf("%w: error occurred while enabling TOTP: %v", models.ErrInternalServer, err))
+	}
+	return nil
+}
+
+// UseTOTPStep - records that a code of the time step was used. It returns false if a code of the same or a later
+// step was used already, so that a code seen by someone else cannot be replayed
+func (r *mfaRepository) UseTOTPStep(publicID string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `UPDATE totp_secrets SET last_used_step = $2
+	WHERE user_id = (SELECT id FROM users WHERE public_id = $1) AND enabled AND last_used_step < $2`
+	res, err := r.db.Exec(ctx, query, publicID, step)
+	if err != nil {
+		return false, fmt.Errorf("%w: error occurred while using TOTP code: %v", models.ErrInternalServer, err)
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode - uses up the recovery code of the user with the hash. It returns false if there is no such unused code
+func (r *mfaRepository) UseRecoveryCode(publicID, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `UPDATE recovery_codes SET used_at = now()
+	WHERE user_id = (SELECT id FROM users WHERE public_id = $1) AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.db.Exec(ctx, query, publicID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("%w: error occurred while using recovery code: %v", models.ErrInternalServer, err)
+	}
+	return res.RowsAffected() > 0, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation
+const uniqueViolation = "23505"
+
+type passkeyRepository struct {
+	db     *pgxpool.Pool
+	cfg    *config.DBConf
+	logger *zap.SugaredLogger
+}
+
+func NewPasskeyRepository(db *pgxpool.Pool, cfg *config.DBConf, logger *zap.SugaredLogger) PasskeyRepository {
+	return &passkeyRepository{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+func (r *passkeyRepository) CreatePasskey(publicID string, passkey *models.Passkey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `INSERT INTO webauthn_credentials
+	(user_id, credential_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state)
+	SELECT id, $2, $3, $4, $5, $6, $7, $8, $9 FROM users WHERE public_id = $1`
+	res, err := r.db.Exec(ctx, query, publicID, passkey.CredentialID, passkey.PublicKey, passkey.AttestationType,
+		passkey.Transports, passkey.AAGUID, int64(passkey.SignCount), passkey.BackupEligible, passkey.BackupState)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return fmt.Errorf("passkey of user %s: %w", publicID, models.ErrPasskeyExists)
+		}
+		return fmt.Errorf("%w: error occurred while storing passkey: %v", models.ErrInternalServer, err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("%w: error occurred while storing passkey: user %s does not exist", models.ErrInternalServer, publicID)
+	}
+	return nil
+}
+
+func (r *passkeyRepository) GetPasskeys(publicID string) ([]*models.Passkey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `SELECT w.credential_id, w.public_key, w.attestation_type, w.transports, w.aaguid, w.sign_count,
+		w.backup_eligible, w.backup_state, w.created_at, w.last_used_at
+	FROM webauthn_credentials as w
+	JOIN users as u ON u.id = w.user_id
+	WHERE u.public_id = $1
+	ORDER BY w.created_at`
+	rows, err := r.db.Query(ctx, query, publicID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error occurred while getting passkeys from db: %v", models.ErrInternalServer, err)
+	}
+	defer rows.Close()
+
+	passkeys := make([]*models.Passkey, 0)
+	for rows.Next() {
+		passkey := &models.Passkey{}
+		var signCount int64
+		if err := rows.Scan(&passkey.CredentialID, &passkey.PublicKey, &passkey.AttestationType, &passkey.Transports, &passkey.AAGUID,
+			&signCount, &passkey.BackupEligible, &passkey.BackupState, &passkey.CreatedAt, &passkey.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("%w: error occurred while getting passkeys from db: %v", models.ErrInternalServer, err)
+		}
+		passkey.SignCount = uint32(signCount)
+		passkeys = append(passkeys, passkey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: error occurred while getting passkeys from db: %v", models.ErrInternalServer, err)
+	}
+	return passkeys, nil
+}
+
+// UsePasskey - records a sign-in with the passkey and its new signature counter. It returns false if the stored counter
+// moved past signCount in the meantime, which means a concurrent sign-in with a clone of the passkey
+func (r *passkeyRepository) UsePasskey(credentialID []byte, signCount uint32) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TimeOut)
+	defer cancel()
+	query := `UPDATE webauthn_credentials SET sign_count = $2, last_used_at = now()
+	WHERE credential_id = $1 AND (sign_count < $2 OR $2 = 0)`
+	res, err := r.db.Exec(ctx, query, credentialID, int64(signCount))
+	if err != nil {
+		return false, fmt.Errorf("%w: error occurred while updating passkey: %v", models.ErrInternalServer, err)
+	}
+	return res.RowsAffected() == 1, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// testDB - connects to the database of TEST_DATABASE_URL, initialized with scripts/init.sql, e.g. the one of
+// docker-compose. Tests that need postgres are skipped without it
+func testDB(t *testing.T) (*pgxpool.Pool, *config.DBConf) {
+	t.Helper()
+	dbURL, ok := os.LookupEnv("TEST_DATABASE_URL")
+	if !ok {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	cfg := &config.DBConf{TimeOut: 5 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TimeOut)
+	defer cancel()
+	db, err := pgxpool.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db, cfg
+}
+
+// createTestUser - inserts a user that is deleted with everything referencing it when the test ends
+func createTestUser(t *testing.T, db *pgxpool.Pool) string {
+	t.Helper()
+	var publicID string
+	err := db.QueryRow(context.Background(),
+		`INSERT INTO users (first_name) VALUES ('passkey test') RETURNING public_id::text`).Scan(&publicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(context.Background(), `DELETE FROM users WHERE public_id = $1`, publicID); err != nil {
+			t.Error(err)
+		}
+	})
+	return publicID
+}
+
+// newTestPasskey - a passkey with a random credential id and sign count 1
+func newTestPasskey(t *testing.T) *models.Passkey {
+	t.Helper()
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &models.Passkey{CredentialID: credentialID, PublicKey: []byte{1}, Transports: []string{}, SignCount: 1}
+}
+
+func TestUsePasskey(t *testing.T) {
+	db, cfg := testDB(t)
+	repo := NewPasskeyRepository(db, cfg, zap.NewNop().Sugar())
+	publicID := createTestUser(t, db)
+
+	passkey := newTestPasskey(t)
+	credentialID := passkey.CredentialID
+	err := repo.CreatePasskey(publicID, passkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		signCount uint32
+		used      bool
+		stored    uint32
+	}{
+		{signCount: 5, used: true, stored: 5},
+		// the same counter again is a replay or a clone
+		{signCount: 5, used: false, stored: 5},
+		{signCount: 3, used: false, stored: 5},
+		{signCount: 6, used: true, stored: 6},
+		// authenticators that do not implement a counter always report zero
+		{signCount: 0, used: true, stored: 0},
+	}
+	for _, step := range steps {
+		used, err := repo.UsePasskey(credentialID, step.signCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != step.used {
+			t.Fatalf("sign count %d: used = %v, want %v", step.signCount, used, step.used)
+		}
+		passkeys, err := repo.GetPasskeys(publicID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(passkeys) != 1 || passkeys[0].SignCount != step.stored {
+			t.Fatalf("sign count %d: stored passkeys %+v, want sign count %d", step.signCount, passkeys, step.stored)
+		}
+	}
+
+	used, err := repo.UsePasskey([]byte("unknown"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used {
+		t.Fatal("an unknown passkey was used")
+	}
+}
+
+func TestCreatePasskeyExists(t *testing.T) {
+	db, cfg := testDB(t)
+	repo := NewPasskeyRepository(db, cfg, zap.NewNop().Sugar())
+	publicID := createTestUser(t, db)
+
+	passkey := newTestPasskey(t)
+	if err := repo.CreatePasskey(publicID, passkey); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.CreatePasskey(createTestUser(t, db), passkey)
+	if !errors.Is(err, models.ErrPasskeyExists) {
+		t.Fatalf("got %v, want %v", err, models.ErrPasskeyExists)
+	}
+}
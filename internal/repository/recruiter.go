@@ -85,9 +85,9 @@ func (r *recruiterRepository) CreateRecruiter(recruiter *models.RecruiterSignUpR
 		}
 	}
 
-	query = `INSERT INTO auth (user_id, login, password) VALUES ($1, $2, $3);`
+	query = `INSERT INTO auth (user_id, login, password, pepper_version) VALUES ($1, $2, $3, $4);`
 
-	_, err = tx.Exec(ctx, query, user_id, recruiter.Login, recruiter.Password)
+	_, err = tx.Exec(ctx, query, user_id, recruiter.Login, recruiter.Password, recruiter.PepperVersion)
 	if err != nil {
 		r.logger.Errorf("Error occurred while creating authentication info: %v %d %s %s", err, user_id, recruiter.Login, recruiter.Password)
 		return err
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/Zhiyenbek/users-auth-service/config"
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
 	"github.com/go-redis/redis/v7"
@@ -11,12 +13,26 @@ import (
 type Repository struct {
 	AuthRepository
 	TokenRepository
+	RevocationRepository
+	ResetRepository
+	ThrottleRepository
+	MFARepository
+	ChallengeRepository
+	PasskeyRepository
+	CeremonyRepository
+	MagicLinkRepository
+	DeviceRepository
 	RecruiterRepository
 	CandidateRepository
 }
 
 type AuthRepository interface {
-	GetUserInfoByLogin(login string) (string, string, error)
+	GetUserInfoByLogin(login string) (*models.Credentials, error)
+	GetCredentials(publicID string) (*models.Credentials, error)
+	GetEmailByLogin(login string) (string, string, error)
+	UpdatePassword(publicID, passwordHash string, pepperVersion int) error
+	ChangePassword(publicID, passwordHash string, pepperVersion int, historySize int) error
+	GetPasswordHistory(publicID string, limit int) ([]*models.PasswordHistoryEntry, error)
 	Exists(loging string) (bool, error)
 }
 
@@ -30,16 +46,100 @@ type CandidateRepository interface {
 }
 
 type TokenRepository interface {
-	SetRTToken(token *models.Token) error
-	UnsetRTToken(publicID string) error
-	GetToken(publicID string) (string, error)
+	CreateSession(session *models.Session, ttl time.Duration) error
+	GetSession(sessionID string) (*models.Session, error)
+	GetSessions(publicID string) ([]*models.Session, error)
+	RotateSession(session *models.Session, oldTokenID string, successor *models.Tokens, ttl, grace time.Duration) (*models.Tokens, error)
+	DeleteSession(publicID, sessionID string) error
+	DeleteSessions(publicID string) ([]string, error)
+	DeleteSessionsExcept(publicID, sessionID string) ([]string, error)
+}
+
+type RevocationRepository interface {
+	RevokeToken(tokenID string, ttl time.Duration) error
+	RevokeSession(sessionID string, ttl time.Duration) error
+	IsRevoked(tokenID, sessionID string) (bool, error)
+}
+
+// ResetRepository - single use password reset tokens, looked up by their hash
+type ResetRepository interface {
+	CreateResetToken(publicID, tokenHash string, ttl time.Duration) error
+	GetResetToken(tokenHash string) (string, error)
+	DeleteResetToken(publicID, tokenHash string) error
+}
+
+// ThrottleRepository - counts failed sign-ins per login and client IP. Blocked returns whether the login is locked out
+// and how long sign-in stays blocked, RecordFailure returns whether the failure locked the login out.
+// RecordEmail counts an email to the address asked for from the IP, or returns how long to wait when a limit is reached
+type ThrottleRepository interface {
+	Blocked(login, ip string) (bool, time.Duration, error)
+	RecordFailure(login, ip string) (bool, error)
+	ClearFailures(login string) error
+	RecordEmail(address, ip string) (time.Duration, error)
+}
+
+// MFARepository - the second factors of users: a TOTP secret and one-time recovery codes, stored by their hash
+type MFARepository interface {
+	CreateTOTP(publicID, secret string) error
+	GetTOTP(publicID string) (*models.TOTP, error)
+	EnableTOTP(publicID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(publicID string, step int64) (bool, error)
+	UseRecoveryCode(publicID, codeHash string) (bool, error)
+}
+
+// ChallengeRepository - sign-ins waiting for the second factor, looked up by the hash of their MFA token.
+// FailChallenge returns whether the challenge was dropped after too many wrong codes
+type ChallengeRepository interface {
+	CreateChallenge(tokenHash string, challenge *models.MFAChallenge, ttl time.Duration) error
+	GetChallenge(tokenHash string) (*models.MFAChallenge, error)
+	FailChallenge(tokenHash string, maxAttempts int) (bool, error)
+	DeleteChallenge(tokenHash string) error
+}
+
+// PasskeyRepository - the WebAuthn credentials of users. UsePasskey returns false if the signature counter
+// did not increase, see models.Passkey
+type PasskeyRepository interface {
+	CreatePasskey(publicID string, passkey *models.Passkey) error
+	GetPasskeys(publicID string) ([]*models.Passkey, error)
+	UsePasskey(credentialID []byte, signCount uint32) (bool, error)
+}
+
+// CeremonyRepository - WebAuthn ceremonies waiting for the response of the authenticator, looked up by their challenge
+type CeremonyRepository interface {
+	CreateCeremony(challenge string, ceremony *models.PasskeyCeremony, ttl time.Duration) error
+	TakeCeremony(challenge string) (*models.PasskeyCeremony, error)
+}
+
+// MagicLinkRepository - single use sign-in links and codes emailed to a login, looked up by their hash. Redeeming either
+// of them uses up both, RedeemMagicCode fails with models.ErrWrongCredential for a wrong or missing code
+type MagicLinkRepository interface {
+	CreateMagicLink(login, tokenHash, codeHash string, ttl time.Duration) error
+	RedeemMagicLink(tokenHash string) (string, error)
+	RedeemMagicCode(login, codeHash string, maxAttempts int) error
+}
+
+// DeviceRepository - the devices users chose to trust on sign-in with the second factor, looked up by the hash of their
+// device token. DeleteDevices forgets the devices remembered in the session, or every device of the user for an empty session id
+type DeviceRepository interface {
+	CreateDevice(device *models.TrustedDevice, ttl time.Duration) error
+	IsTrustedDevice(publicID, tokenHash string) (bool, error)
+	DeleteDevices(publicID, sessionID string) error
 }
 
 func New(db *pgxpool.Pool, cfg *config.Configs, redis *redis.Client, log *zap.SugaredLogger) *Repository {
 	return &Repository{
-		AuthRepository:      NewAuthRepository(db, cfg.DB, log),
-		TokenRepository:     NewTokenRepository(redis),
-		RecruiterRepository: NewRecruiterRepository(db, cfg.DB, log),
-		CandidateRepository: NewCandidateRepository(db, cfg.DB, log),
+		AuthRepository:       NewAuthRepository(db, cfg.DB, log),
+		TokenRepository:      NewTokenRepository(redis),
+		RevocationRepository: NewRevocationRepository(redis, cfg.Token.Revocation.CacheTTL),
+		ResetRepository:      NewResetRepository(redis),
+		ThrottleRepository:   NewThrottleRepository(redis, cfg.Throttle),
+		MFARepository:        NewMFARepository(db, cfg.DB, log),
+		ChallengeRepository:  NewChallengeRepository(redis),
+		PasskeyRepository:    NewPasskeyRepository(db, cfg.DB, log),
+		CeremonyRepository:   NewCeremonyRepository(redis),
+		MagicLinkRepository:  NewMagicLinkRepository(redis),
+		DeviceRepository:     NewDeviceRepository(redis),
+		RecruiterRepository:  NewRecruiterRepository(db, cfg.DB, log),
+		CandidateRepository:  NewCandidateRepository(db, cfg.DB, log),
 	}
 }
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+type resetRepository struct {
+	client *redis.Client
+}
+
+func NewResetRepository(client *redis.Client) ResetRepository {
+	return &resetRepository{
+		client: client,
+	}
+}
+
+// createResetTokenScript stores a reset token and drops the previous one of the user, so only the latest emailed link works.
+var createResetTokenScript = redis.NewScript(`
+local previous = redis.call('GET', KEYS[2])
+if previous then
+	redis.call('DEL', ARGV[3] .. previous)
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[4])
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[4])
+return 1
+`)
+
+// deleteResetTokenScript deletes a reset token of the user. It returns 0 if the token was already used or expired.
+var deleteResetTokenScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+if redis.call('GET', KEYS[2]) == ARGV[2] then
+	redis.call('DEL', KEYS[2])
+end
+return 1
+`)
+
+func resetTokenKey(tokenHash string) string {
+	return "password_reset:" + tokenHash
+}
+
+func userResetTokenKey(publicID string) string {
+	return "user_password_reset:" + publicID
+}
+
+func (r *resetRepository) CreateResetToken(publicID, tokenHash string, ttl time.Duration) error {
+	keys := []string{resetTokenKey(tokenHash), userResetTokenKey(publicID)}
+	err := createResetTokenScript.Run(r.client, keys, publicID, tokenHash, resetTokenKey(""), ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("%w could not store password reset token of user %s: %v", models.ErrInternalServer, publicID, err)
+	}
+	return nil
+}
+
+func (r *resetRepository) GetResetToken(tokenHash string) (string, error) {
+	publicID, err := r.client.Get(resetTokenKey(tokenHash)).Result()
+	if err == redis.Nil {
+		return "", fmt.Errorf("password reset token does not exist in storage: %w", models.ErrInvalidToken)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w could not retrieve password reset token from redis: %v", models.ErrInternalServer, err)
+	}
+	return publicID, nil
+}
+
+func (r *resetRepository) DeleteResetToken(publicID, tokenHash string) error {
+	keys := []string{resetTokenKey(tokenHash), userResetTokenKey(publicID)}
+	res, err := deleteResetTokenScript.Run(r.client, keys, publicID, tokenHash).Int()
+	if err != nil {
+		return fmt.Errorf("%w could not delete password reset token of user %s: %v", models.ErrInternalServer, publicID, err)
+	}
+	if res == 0 {
+		return fmt.Errorf("password reset token was already used: %w", models.ErrInvalidToken)
+	}
+	return nil
+}
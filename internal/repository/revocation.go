@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+// revocationCacheSize is the maximum number of cached entries, the least recently used one is evicted beyond it.
+const revocationCacheSize = 10000
+
+// revocationRepository is a denylist of access tokens and sessions kept in redis.
+// Answers are cached in process: revocations until the revoked token would have expired anyway,
+// and the absence of a revocation for cacheTTL, so most verifications do not reach redis.
+// Redis stays the source of truth, so evicting an entry early only costs another lookup.
+type revocationRepository struct {
+	client   *redis.Client
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*list.Element
+	lru   *list.List
+}
+
+type revocationEntry struct {
+	key     string
+	revoked bool
+	until   time.Time
+}
+
+func NewRevocationRepository(client *redis.Client, cacheTTL time.Duration) RevocationRepository {
+	return &revocationRepository{
+		client:   client,
+		cacheTTL: cacheTTL,
+		cache:    map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+func revokedTokenKey(tokenID string) string {
+	return "revoked_token:" + tokenID
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "revoked_session:" + sessionID
+}
+
+func (r *revocationRepository) RevokeToken(tokenID string, ttl time.Duration) error {
+	return r.revoke(revokedTokenKey(tokenID), ttl)
+}
+
+func (r *revocationRepository) RevokeSession(sessionID string, ttl time.Duration) error {
+	return r.revoke(revokedSessionKey(sessionID), ttl)
+}
+
+func (r *revocationRepository) revoke(key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if err := r.client.Set(key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("%w could not add %s to the revocation list: %v", models.ErrInternalServer, key, err)
+	}
+	r.store(&revocationEntry{key: key, revoked: true, until: time.Now().Add(ttl)})
+	return nil
+}
+
+func (r *revocationRepository) IsRevoked(tokenID, sessionID string) (bool, error) {
+	keys := make([]string, 0, 2)
+	if tokenID != "" {
+		keys = append(keys, revokedTokenKey(tokenID))
+	}
+	if sessionID != "" {
+		keys = append(keys, revokedSessionKey(sessionID))
+	}
+
+	now := time.Now()
+	missing := make([]string, 0, len(keys))
+	r.mu.Lock()
+	for _, key := range keys {
+		entry := r.lookup(key, now)
+		if entry == nil {
+			missing = append(missing, key)
+			continue
+		}
+		if entry.revoked {
+			r.mu.Unlock()
+			return true, nil
+		}
+	}
+	r.mu.Unlock()
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	cmds := make([]*redis.DurationCmd, len(missing))
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, key := range missing {
+			cmds[i] = pipe.PTTL(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w could not check the revocation list: %v", models.ErrInternalServer, err)
+	}
+
+	revoked := false
+	for i, cmd := range cmds {
+		// PTTL is negative when the key does not exist
+		if ttl := cmd.Val(); ttl > 0 {
+			revoked = true
+			r.store(&revocationEntry{key: missing[i], revoked: true, until: now.Add(ttl)})
+			continue
+		}
+		r.store(&revocationEntry{key: missing[i], until: now.Add(r.cacheTTL)})
+	}
+	return revoked, nil
+}
+
+// lookup - returns the cached entry of the key unless it expired, expired entries are dropped. r.mu must be held
+func (r *revocationRepository) lookup(key string, now time.Time) *revocationEntry {
+	elem, ok := r.cache[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*revocationEntry)
+	if now.After(entry.until) {
+		r.lru.Remove(elem)
+		delete(r.cache, key)
+		return nil
+	}
+	r.lru.MoveToFront(elem)
+	return entry
+}
+
+func (r *revocationRepository) store(entry *revocationEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if elem, ok := r.cache[entry.key]; ok {
+		elem.Value = entry
+		r.lru.MoveToFront(elem)
+		return
+	}
+	r.cache[entry.key] = r.lru.PushFront(entry)
+	for r.lru.Len() > revocationCacheSize {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.cache, oldest.Value.(*revocationEntry).key)
+	}
+}
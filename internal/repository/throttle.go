@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/go-redis/redis/v7"
+)
+
+// Values of a block key, only a lockout of the login itself is reported as a locked account.
+const (
+	blockDelayed = "delayed"
+	blockLocked  = "locked"
+)
+
+// throttleRepository counts failed sign-ins per login and per client IP in redis and blocks further
+// attempts with an exponential back-off and, past a threshold, a lockout.
+type throttleRepository struct {
+	client *redis.Client
+	cfg    *config.ThrottleConf
+}
+
+func NewThrottleRepository(client *redis.Client, cfg *config.ThrottleConf) ThrottleRepository {
+	return &throttleRepository{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+// recordFailureScript counts a failure in KEYS[1] and blocks sign-in by setting KEYS[2] for a while.
+// It returns 1 if the failure reached the lockout threshold and 0 otherwise.
+var recordFailureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+local threshold = tonumber(ARGV[5])
+if threshold > 0 and failures >= threshold then
+	redis.call('SET', KEYS[2], ARGV[7], 'PX', ARGV[6])
+	return 1
+end
+local free = tonumber(ARGV[2])
+if failures > free then
+	local delay = tonumber(ARGV[3]) * 2 ^ (failures - free - 1)
+	if delay > tonumber(ARGV[4]) then
+		delay = tonumber(ARGV[4])
+	end
+	if delay >= 1 then
+		redis.call('SET', KEYS[2], 'delayed', 'PX', math.floor(delay))
+	end
+end
+return 0
+`)
+
+func loginFailuresKey(login string) string {
+	return "login_failures:" + login
+}
+
+func loginBlockKey(login string) string {
+	return "login_block:" + login
+}
+
+func ipFailuresKey(ip string) string {
+	return "ip_failures:" + ip
+}
+
+func ipBlockKey(ip string) string {
+	return "ip_block:" + ip
+}
+
+func emailSendsKey(address string) string {
+	return "email_sends:" + strings.ToLower(address)
+}
+
+func ipEmailSendsKey(ip string) string {
+	return "ip_email_sends:" + ip
+}
+
+// recordEmailScript counts an email in KEYS[1], the sends to the address, and KEYS[2], the sends asked for from the IP,
+// within a fixed window. If either count reached its limit nothing is counted and the time until it resets is returned.
+var recordEmailScript = redis.NewScript(`
+local limits = {tonumber(ARGV[2]), tonumber(ARGV[3])}
+local retryAfter = 0
+for i, key in ipairs(KEYS) do
+	if limits[i] > 0 and tonumber(redis.call('GET', key) or '0') >= limits[i] then
+		local ttl = redis.call('PTTL', key)
+		if ttl > retryAfter then
+			retryAfter = ttl
+		end
+	end
+end
+if retryAfter > 0 then
+	return retryAfter
+end
+for _, key in ipairs(KEYS) do
+	if redis.call('INCR', key) == 1 then
+		redis.call('PEXPIRE', key, ARGV[1])
+	end
+end
+return 0
+`)
+
+func (r *throttleRepository) Blocked(login, ip string) (bool, time.Duration, error) {
+	if r.cfg == nil {
+		return false, 0, nil
+	}
+	keys := []string{loginBlockKey(login), ipBlockKey(ip)}
+	values := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			values[i] = pipe.Get(key)
+			ttls[i] = pipe.PTTL(key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return false, 0, fmt.Errorf("%w could not check sign-in blocks of %s from %s: %v", models.ErrInternalServer, login, ip, err)
+	}
+
+	var (
+		locked     bool
+		retryAfter time.Duration
+	)
+	for i := range keys {
+		// PTTL is negative when the key does not exist
+		ttl := ttls[i].Val()
+		if ttl <= 0 {
+			continue
+		}
+		if values[i].Val() == blockLocked {
+			locked = true
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	return locked, retryAfter, nil
+}
+
+func (r *throttleRepository) RecordFailure(login, ip string) (bool, error) {
+	if r.cfg == nil {
+		return false, nil
+	}
+	lockedOut, err := r.recordFailure(loginFailuresKey(login), loginBlockKey(login), r.cfg.Login, blockLocked)
+	if err != nil {
+		return false, err
+	}
+	// a lockout of an IP only slows it down, it does not mean that any account is locked
+	_, err = r.recordFailure(ipFailuresKey(ip), ipBlockKey(ip), r.cfg.IP, blockDelayed)
+	if err != nil {
+		return false, err
+	}
+	return lockedOut, nil
+}
+
+func (r *throttleRepository) recordFailure(failuresKey, blockKey string, rule *config.ThrottleRuleConf, lockValue string) (bool, error) {
+	if rule == nil {
+		return false, nil
+	}
+	keys := []string{failuresKey, blockKey}
+	res, err := recordFailureScript.Run(r.client, keys,
+		r.cfg.Window.Milliseconds(), rule.FreeAttempts, rule.BaseDelay.Milliseconds(), rule.MaxDelay.Milliseconds(),
+		rule.LockoutThreshold, rule.LockoutDuration.Milliseconds(), lockValue,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("%w could not record failed sign-in in %s: %v", models.ErrInternalServer, failuresKey, err)
+	}
+	return res == 1, nil
+}
+
+func (r *throttleRepository) ClearFailures(login string) error {
+	err := r.client.Del(loginFailuresKey(login), loginBlockKey(login)).Err()
+	if err != nil {
+		return fmt.Errorf("%w could not clear failed sign-ins of %s: %v", models.ErrInternalServer, login, err)
+	}
+	return nil
+}
+
+func (r *throttleRepository) RecordEmail(address, ip string) (time.Duration, error) {
+	if r.cfg == nil || r.cfg.Email == nil {
+		return 0, nil
+	}
+	keys := []string{emailSendsKey(address), ipEmailSendsKey(ip)}
+	retryAfter, err := recordEmailScript.Run(r.client, keys,
+		r.cfg.Email.Window.Milliseconds(), r.cfg.Email.PerAddress, r.cfg.Email.PerIP,
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%w could not count email to %s from %s: %v", models.ErrInternalServer, address, ip, err)
+	}
+	return time.Duration(retryAfter) * time.Millisecond, nil
+}
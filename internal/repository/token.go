@@ -1,8 +1,9 @@
 package repository
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
 	"github.com/go-redis/redis/v7"
@@ -17,31 +18,222 @@ func NewTokenRepository(client *redis.Client) TokenRepository {
 		client: client,
 	}
 }
-func (r *tokenRepository) SetRTToken(token *models.Token) error {
-	key := token.PublicID
-	if err := r.client.Set(key, token.TokenValue, token.TTL).Err(); err != nil {
-		return fmt.Errorf("%w could not set refresh token to redis for TokenValue : %s: %v", models.ErrInternalServer, token.TokenValue, err)
+
+// rotateSessionScript swaps the refresh token id of a session only if the presented one is current.
+// A session is the family of all refresh tokens issued for it, so presenting an already rotated token
+// means it was stolen and the whole family is revoked. Within the grace period ARGV[10] of a rotation the
+// rotated token gets the successor it was rotated to, which is kept in KEYS[3], instead.
+// It returns -1 if the session does not exist, 0 if a rotated token was reused, 1 on success and
+// the access and refresh tokens of the successor for a token rotated within the grace period.
+var rotateSessionScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'refresh_token_id')
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	local successor = redis.call('HMGET', KEYS[3], 'access_token', 'refresh_token')
+	if successor[1] and successor[2] then
+		return successor
+	end
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', KEYS[2], ARGV[7])
+	return 0
+end
+redis.call('HSET', KEYS[1], 'refresh_token_id', ARGV[2], 'last_refresh_at', ARGV[3], 'user_agent', ARGV[5], 'ip', ARGV[6])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+if tonumber(ARGV[10]) > 0 then
+	redis.call('HSET', KEYS[3], 'access_token', ARGV[8], 'refresh_token', ARGV[9])
+	redis.call('PEXPIRE', KEYS[3], ARGV[10])
+end
+return 1
+`)
+
+// deleteSessionScript deletes a session only if it belongs to the user. It returns 0 if it does not.
+var deleteSessionScript = redis.NewScript(`
+if redis.call('SREM', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// deleteSessionsScript deletes every session of a user but the one in ARGV[2] atomically, so no session
+// created concurrently is left behind unlisted. It returns the ids of the deleted sessions.
+var deleteSessionsScript = redis.NewScript(`
+local ids = redis.call('SMEMBERS', KEYS[1])
+local deleted = {}
+for _, id in ipairs(ids) do
+	if id ~= ARGV[2] then
+		redis.call('DEL', ARGV[1] .. id)
+		redis.call('SREM', KEYS[1], id)
+		table.insert(deleted, id)
+	end
+end
+return deleted
+`)
+
+func sessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// rotatedTokenKey holds the successor of a refresh token for the grace period after its rotation
+func rotatedTokenKey(tokenID string) string {
+	return "rotated_refresh_token:" + tokenID
+}
+
+func userSessionsKey(publicID string) string {
+	return "user_sessions:" + publicID
+}
+
+func (r *tokenRepository) CreateSession(session *models.Session, ttl time.Duration) error {
+	key := sessionKey(session.ID)
+	setKey := userSessionsKey(session.PublicID)
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, map[string]interface{}{
+			"public_id":        session.PublicID,
+			"role":             session.Role,
+			"refresh_token_id": session.RefreshTokenID,
+			"created_at":       session.CreatedAt.Unix(),
+			"last_refresh_at":  session.LastRefreshAt.Unix(),
+			"user_agent":       session.UserAgent,
+			"ip":               session.IP,
+		})
+		pipe.Expire(key, ttl)
+		pipe.SAdd(setKey, session.ID)
+		pipe.Expire(setKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w could not create session %s in redis: %v", models.ErrInternalServer, session.ID, err)
 	}
 	return nil
 }
 
-func (r *tokenRepository) UnsetRTToken(publicID string) error {
-	key := publicID
-	if err := r.client.Del(key).Err(); err != nil {
-		return fmt.Errorf("%w could not delete refresh token to redis for TokenValue : %v", models.ErrInternalServer, err)
+func (r *tokenRepository) GetSession(sessionID string) (*models.Session, error) {
+	fields, err := r.client.HGetAll(sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w could not retrieve session %s from redis: %v", models.ErrInternalServer, sessionID, err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("session %s: %w", sessionID, models.ErrSessionNotFound)
+	}
+	return sessionFromHash(sessionID, fields), nil
+}
+
+func (r *tokenRepository) GetSessions(publicID string) ([]*models.Session, error) {
+	setKey := userSessionsKey(publicID)
+	ids, err := r.client.SMembers(setKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w could not retrieve sessions of user %s from redis: %v", models.ErrInternalServer, publicID, err)
+	}
+	if len(ids) == 0 {
+		return []*models.Session{}, nil
+	}
+
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(sessionKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w could not retrieve sessions of user %s from redis: %v", models.ErrInternalServer, publicID, err)
+	}
+
+	sessions := make([]*models.Session, 0, len(ids))
+	var expired []interface{}
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+		sessions = append(sessions, sessionFromHash(ids[i], fields))
+	}
+	// sessions expire on their own, so the set of a user is cleaned up lazily
+	if len(expired) > 0 {
+		if err := r.client.SRem(setKey, expired...).Err(); err != nil {
+			return nil, fmt.Errorf("%w could not clean up expired sessions of user %s: %v", models.ErrInternalServer, publicID, err)
+		}
+	}
+	return sessions, nil
+}
+
+// RotateSession - rotates the refresh token of the session to successor. If the old token was rotated within grace
+// already, the successor it was rotated to is returned with only the token values set
+func (r *tokenRepository) RotateSession(session *models.Session, oldTokenID string, successor *models.Tokens, ttl, grace time.Duration) (*models.Tokens, error) {
+	keys := []string{sessionKey(session.ID), userSessionsKey(session.PublicID), rotatedTokenKey(oldTokenID)}
+	res, err := rotateSessionScript.Run(r.client, keys, oldTokenID, session.RefreshTokenID, session.LastRefreshAt.Unix(), ttl.Milliseconds(),
+		session.UserAgent, session.IP, session.ID, successor.AccessToken.TokenValue, successor.RefreshToken.TokenValue, grace.Milliseconds()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w could not rotate refresh token of session %s: %v", models.ErrInternalServer, session.ID, err)
+	}
+	if rotated, ok := res.([]interface{}); ok && len(rotated) == 2 {
+		accessToken, _ := rotated[0].(string)
+		refreshToken, _ := rotated[1].(string)
+		return &models.Tokens{
+			AccessToken:  &models.Token{TokenValue: accessToken},
+			RefreshToken: &models.Token{TokenValue: refreshToken},
+		}, nil
+	}
+	switch res {
+	case int64(-1):
+		return nil, fmt.Errorf("session does not exist in storage: %w", models.ErrTokenExpired)
+	case int64(0):
+		return nil, fmt.Errorf("rotated refresh token was reused, session %s is revoked: %w", session.ID, models.ErrTokenReused)
+	}
+	return nil, nil
+}
+
+func (r *tokenRepository) DeleteSession(publicID, sessionID string) error {
+	keys := []string{sessionKey(sessionID), userSessionsKey(publicID)}
+	res, err := deleteSessionScript.Run(r.client, keys, sessionID).Int()
+	if err != nil {
+		return fmt.Errorf("%w could not delete session %s from redis: %v", models.ErrInternalServer, sessionID, err)
+	}
+	if res == 0 {
+		return fmt.Errorf("session %s of user %s: %w", sessionID, publicID, models.ErrSessionNotFound)
 	}
 	return nil
 }
 
-func (r *tokenRepository) GetToken(publicID string) (string, error) {
-	key := publicID
-	value := r.client.Get(key)
-	TokenValue, err := value.Result()
-	if err != nil || TokenValue == "" {
-		if errors.Is(err, redis.Nil) {
-			return "", fmt.Errorf("token does not exist in storage: %w", models.ErrTokenExpired)
+func (r *tokenRepository) DeleteSessions(publicID string) ([]string, error) {
+	return r.DeleteSessionsExcept(publicID, "")
+}
+
+// DeleteSessionsExcept - deletes every session of the user but the given one, e.g. the one a password was changed from
+func (r *tokenRepository) DeleteSessionsExcept(publicID, sessionID string) ([]string, error) {
+	keys := []string{userSessionsKey(publicID)}
+	res, err := deleteSessionsScript.Run(r.client, keys, sessionKey(""), sessionID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w could not delete sessions of user %s from redis: %v", models.ErrInternalServer, publicID, err)
+	}
+	values, _ := res.([]interface{})
+	ids := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
 		}
-		return "", fmt.Errorf("%w could not retrieve refresh token from redis for TokenValue : %v", models.ErrInternalServer, err)
 	}
-	return TokenValue, nil
+	return ids, nil
+}
+
+func sessionFromHash(sessionID string, fields map[string]string) *models.Session {
+	return &models.Session{
+		ID:             sessionID,
+		PublicID:       fields["public_id"],
+		Role:           fields["role"],
+		RefreshTokenID: fields["refresh_token_id"],
+		CreatedAt:      unixField(fields["created_at"]),
+		LastRefreshAt:  unixField(fields["last_refresh_at"]),
+		UserAgent:      fields["user_agent"],
+		IP:             fields["ip"],
+	}
+}
+
+func unixField(value string) time.Time {
+	sec, _ := strconv.ParseInt(value, 10, 64)
+	return time.Unix(sec, 0)
 }
@@ -1,49 +1,472 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/audit"
+	"github.com/Zhiyenbek/users-auth-service/internal/mailer"
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/Zhiyenbek/users-auth-service/internal/password"
 	"github.com/Zhiyenbek/users-auth-service/internal/repository"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type authService struct {
 	cfg           *config.Configs
 	logger        *zap.SugaredLogger
+	audit         audit.Logger
+	tokens        *token.Manager
+	passwords     *password.Hasher
+	policy        *password.Policy
+	breached      password.BreachList
+	mailer        mailer.Mailer
+	webAuthn      *webauthn.WebAuthn
 	authRepo      repository.AuthRepository
 	tokenRepo     repository.TokenRepository
+	revokedRepo   repository.RevocationRepository
+	resetRepo     repository.ResetRepository
+	throttleRepo  repository.ThrottleRepository
+	mfaRepo       repository.MFARepository
+	challengeRepo repository.ChallengeRepository
+	passkeyRepo   repository.PasskeyRepository
+	ceremonyRepo  repository.CeremonyRepository
+	magicLinkRepo repository.MagicLinkRepository
+	deviceRepo    repository.DeviceRepository
 	recruiterRepo repository.RecruiterRepository
 	candidateRepo repository.CandidateRepository
 }
 
-func NewAuthService(repo *repository.Repository, cfg *config.Configs, logger *zap.SugaredLogger) AuthService {
+func NewAuthService(repo *repository.Repository, tokens *token.Manager, passwords *password.Hasher, breached password.BreachList, mail mailer.Mailer, webAuthn *webauthn.WebAuthn, cfg *config.Configs, logger *zap.SugaredLogger) AuthService {
 	return &authService{
+		tokens:        tokens,
+		passwords:     passwords,
+		policy:        password.NewPolicy(cfg.Password.Policy),
+		breached:      breached,
+		mailer:        mail,
+		webAuthn:      webAuthn,
 		authRepo:      repo.AuthRepository,
 		tokenRepo:     repo.TokenRepository,
+		revokedRepo:   repo.RevocationRepository,
+		resetRepo:     repo.ResetRepository,
+		throttleRepo:  repo.ThrottleRepository,
+		mfaRepo:       repo.MFARepository,
+		challengeRepo: repo.ChallengeRepository,
+		passkeyRepo:   repo.PasskeyRepository,
+		ceremonyRepo:  repo.CeremonyRepository,
+		magicLinkRepo: repo.MagicLinkRepository,
+		deviceRepo:    repo.DeviceRepository,
 		recruiterRepo: repo.RecruiterRepository,
 		candidateRepo: repo.CandidateRepository,
 		cfg:           cfg,
 		logger:        logger,
+		audit:         audit.New(logger),
 	}
 }
 func (u *authService) SignOut(accessToken string) error {
 
-	token, err := u.parseToken(accessToken, u.cfg.Token.Access.TokenSecret)
+	token, err := u.parseToken(accessToken, models.AccessTokenType)
 	if err != nil {
 		u.logger.Error("Could not parse access token", err)
 		return err
 	}
 
-	return u.tokenRepo.UnsetRTToken(token.PublicID)
+	err = u.revokeToken(token)
+	if err != nil {
+		u.logger.Error(err)
+		return err
+	}
+	return u.endSession(token.PublicID, token.SessionID)
+}
+
+// IsRevoked - checks the access token against the revocation list, by its own id and by its session
+func (s *authService) IsRevoked(token *models.Token) (bool, error) {
+	revoked, err := s.revokedRepo.IsRevoked(token.ID, token.SessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return false, err
+	}
+	return revoked, nil
+}
+
+// Introspect - tells whether the token is an active access or refresh token, see RFC 7662. Tokens are tried in the order suggested by tokenTypeHint
+func (s *authService) Introspect(tokenString, tokenTypeHint string) (*models.IntrospectionResponse, error) {
+	for _, tokenType := range tokenTypes(tokenTypeHint) {
+		token, err := s.parseToken(tokenString, tokenType)
+		if err != nil {
+			continue
+		}
+		active, err := s.isActive(token, tokenType)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			break
+		}
+		return &models.IntrospectionResponse{
+			Active:    true,
+			Subject:   token.PublicID,
+			Role:      token.Role,
+			IssuedAt:  token.IssuedAt.Unix(),
+			ExpiresAt: token.ExpiresAt.Unix(),
+			SessionID: token.SessionID,
+			TokenID:   token.ID,
+			AuthTime:  authTime(token),
+			AMR:       token.AMR,
+			ACR:       token.ACR,
+		}, nil
+	}
+	return &models.IntrospectionResponse{Active: false}, nil
+}
+
+// RevokeToken - revokes an access token or, for a refresh token, its whole session, see RFC 7009. Invalid tokens are ignored
+func (s *authService) RevokeToken(tokenString, tokenTypeHint string) error {
+	for _, tokenType := range tokenTypes(tokenTypeHint) {
+		token, err := s.parseToken(tokenString, tokenType)
+		if err != nil {
+			continue
+		}
+		if tokenType == models.AccessTokenType {
+			err = s.revokeToken(token)
+		} else {
+			err = s.endSession(token.PublicID, token.SessionID)
+		}
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+// isActive - checks that an access token is not revoked, or that a refresh token is the current one of its session
+func (s *authService) isActive(token *models.Token, tokenType string) (bool, error) {
+	if tokenType == models.AccessTokenType {
+		revoked, err := s.IsRevoked(token)
+		return !revoked, err
+	}
+	session, err := s.tokenRepo.GetSession(token.SessionID)
+	if err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			return false, nil
+		}
+		s.logger.Error(err)
+		return false, err
+	}
+	return session.PublicID == token.PublicID && session.RefreshTokenID == token.ID, nil
+}
+
+// tokenTypes - returns the token types to try, the hinted one first
+func tokenTypes(tokenTypeHint string) []string {
+	if tokenTypeHint == models.RefreshTokenHint {
+		return []string{models.RefreshTokenType, models.AccessTokenType}
+	}
+	return []string{models.AccessTokenType, models.RefreshTokenType}
+}
+
+// authTime - returns the auth_time of the token as a unix timestamp, zero for tokens issued without it
+func authTime(token *models.Token) int64 {
+	if token.AuthTime.IsZero() {
+		return 0
+	}
+	return token.AuthTime.Unix()
+}
+
+// revokeToken - denylists the access token until it expires. Tokens are accepted for the leeway past their expiry,
+// so they stay denylisted that much longer
+func (s *authService) revokeToken(token *models.Token) error {
+	return s.revokedRepo.RevokeToken(token.ID, token.TTL+s.cfg.Token.Leeway)
+}
+
+// revokeSession - denylists the access tokens issued for the session. They are denylisted until the longest lived of
+// them expires, an elevated token of a reauthentication may outlive a regular access token, and for the leeway after
+func (s *authService) revokeSession(sessionID string) error {
+	ttl := s.cfg.Token.Access.TTL
+	if s.cfg.Token.StepUp.TTL > ttl {
+		ttl = s.cfg.Token.StepUp.TTL
+	}
+	return s.revokedRepo.RevokeSession(sessionID, ttl+s.cfg.Token.Leeway)
+}
+
+// endSession - deletes the session and revokes access tokens that were issued for it and did not expire yet
+func (s *authService) endSession(publicID, sessionID string) error {
+	err := s.tokenRepo.DeleteSession(publicID, sessionID)
+	if err != nil && !errors.Is(err, models.ErrSessionNotFound) {
+		return err
+	}
+	return s.revokeSession(sessionID)
+}
+
+// ListSessions - returns every active session of the user
+func (s *authService) ListSessions(publicID string) ([]*models.Session, error) {
+	sessions, err := s.tokenRepo.GetSessions(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastRefreshAt.After(sessions[j].LastRefreshAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession - ends a single session of the user, e.g. a device that is no longer in use. A device remembered in the
+// session has to pass the second factor again
+func (s *authService) RevokeSession(publicID, sessionID string) error {
+	err := s.tokenRepo.DeleteSession(publicID, sessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	err = s.revokeSession(sessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	return s.forgetDevices(publicID, sessionID)
+}
+
+// RevokeAllSessions - signs the user out on every device and forgets the trusted devices of the user
+func (s *authService) RevokeAllSessions(publicID string) error {
+	sessionIDs, err := s.tokenRepo.DeleteSessions(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	err = s.revokeSessions(sessionIDs)
+	if err != nil {
+		return err
+	}
+	return s.forgetDevices(publicID, "")
+}
+
+// revokeSessions - revokes the access tokens of sessions that were deleted
+func (s *authService) revokeSessions(sessionIDs []string) error {
+	for _, sessionID := range sessionIDs {
+		err := s.revokeSession(sessionID)
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangePassword - replaces the password of a signed in user after checking the current one and signs the user out
+// on every other device, the session the password was changed from stays signed in. Every trusted device of the user
+// is forgotten. Wrong current passwords count as failed sign-ins of the login
+func (s *authService) ChangePassword(publicID, sessionID string, req *models.ChangePasswordRequest, client *models.ClientInfo) error {
+	stored, err := s.authRepo.GetCredentials(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	locked, retryAfter, err := s.throttleRepo.Blocked(stored.Login, client.IP)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	if retryAfter > 0 {
+		return &models.SignInBlockedError{Locked: locked, RetryAfter: retryAfter}
+	}
+	match, _, err := s.passwords.Verify(req.CurrentPassword, stored.PasswordHash, stored.PepperVersion)
+	if err != nil {
+		s.logger.Errorf("could not verify password hash of user %s: %v", publicID, err)
+	}
+	if !match {
+		s.recordFailure(stored.Login, client)
+		return models.ErrWrongCredential
+	}
+	err = s.throttleRepo.ClearFailures(stored.Login)
+	if err != nil {
+		s.logger.Error(err)
+	}
+	err = s.validateNewPassword(stored, req.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = s.storeNewPassword(publicID, req.NewPassword)
+	if err != nil {
+		return err
+	}
+	sessionIDs, err := s.tokenRepo.DeleteSessionsExcept(publicID, sessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	err = s.revokeSessions(sessionIDs)
+	if err != nil {
+		return err
+	}
+	return s.forgetDevices(publicID, "")
+}
+
+// ForgotPassword - emails a single use password reset link to the user with the login. Whether the login exists is not revealed,
+// the returned error is only meant to be logged. Links are not sent past the email limits of the address and the client IP
+func (s *authService) ForgotPassword(req *models.ForgotPasswordRequest, client *models.ClientInfo) error {
+	publicID, email, err := s.authRepo.GetEmailByLogin(req.Login)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return fmt.Errorf("user %s has no email to send a password reset link to", publicID)
+	}
+	err = s.recordEmail(email, client)
+	if err != nil {
+		return err
+	}
+	resetToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.CreateResetToken(publicID, hashToken(resetToken), s.cfg.Password.Reset.TTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(&mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Somebody asked to reset the password of your account %s.\n\n"+
+			"Follow this link to choose a new password, it expires in %v:\n%s%s\n\n"+
+			"If it was not you, ignore this email and your password will stay the same.\n",
+			req.Login, s.cfg.Password.Reset.TTL, s.cfg.Password.Reset.URL, resetToken),
+	})
+}
+
+// recordEmail - counts an email to the address asked for by the client, it fails once the address or the client IP
+// reached its email limit
+func (s *authService) recordEmail(address string, client *models.ClientInfo) error {
+	retryAfter, err := s.throttleRepo.RecordEmail(address, client.IP)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return fmt.Errorf("%w: email to %s asked for from %s is not sent, retry after %v", models.ErrTooManyAttempts, address, client.IP, retryAfter)
+	}
+	return nil
+}
+
+// ResetPassword - sets a new password with a reset token and signs the user out on every device. The token is used up only
+// when the new password is accepted, so users can retry with a password that meets the policy
+func (s *authService) ResetPassword(req *models.ResetPasswordRequest) error {
+	tokenHash := hashToken(req.Token)
+	publicID, err := s.resetRepo.GetResetToken(tokenHash)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	stored, err := s.authRepo.GetCredentials(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	err = s.validateNewPassword(stored, req.NewPassword)
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.DeleteResetToken(publicID, tokenHash)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	err = s.storeNewPassword(publicID, req.NewPassword)
+	if err != nil {
+		return err
+	}
+	return s.RevokeAllSessions(publicID)
+}
+
+// validateNewPassword - checks a new password of an existing user against the password policy and the recent passwords of the user
+func (s *authService) validateNewPassword(stored *models.Credentials, newPassword string) error {
+	err := s.checkPolicy(&models.UserData{Login: stored.Login, Password: newPassword})
+	if err != nil {
+		return err
+	}
+	return s.checkHistory(stored, newPassword)
+}
+
+// checkHistory - rejects the new password with models.ErrPasswordReused if it is the current password or one of the
+// previous ones kept in the password history
+func (s *authService) checkHistory(stored *models.Credentials, newPassword string) error {
+	size := s.cfg.Password.HistorySize
+	if size <= 0 {
+		return nil
+	}
+	hashes := []*models.PasswordHistoryEntry{{PasswordHash: stored.PasswordHash, PepperVersion: stored.PepperVersion}}
+	if size > 1 {
+		history, err := s.authRepo.GetPasswordHistory(stored.PublicID, size-1)
+		if err != nil {
+			s.logger.Error(err)
+			return err
+		}
+		hashes = append(hashes, history...)
+	}
+	for _, entry := range hashes {
+		match, _, err := s.passwords.Verify(newPassword, entry.PasswordHash, entry.PepperVersion)
+		if err != nil {
+			// e.g. a hash made with a pepper that is no longer configured, it cannot be compared
+			s.logger.Warnf("could not verify previous password hash of user %s: %v", stored.PublicID, err)
+			continue
+		}
+		if match {
+			return models.ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// storeNewPassword - hashes and stores the new password of the user, keeping the replaced one in the password history
+func (s *authService) storeNewPassword(publicID, newPassword string) error {
+	hash, pepperVersion, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		s.logger.Error("could not hash password")
+		return err
+	}
+	keep := s.cfg.Password.HistorySize - 1
+	if keep < 0 {
+		keep = 0
+	}
+	err = s.authRepo.ChangePassword(publicID, hash, pepperVersion, keep)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// randomToken - returns a random url safe token with 256 bits of entropy
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w could not generate random token: %v", models.ErrInternalServer, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken - returns the hash a random token is stored by. Reset tokens, MFA tokens, magic links and codes and device
+// tokens are only stored as hashes, so they cannot be used by anyone able to read redis
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *authService) CreateCandidate(req *models.CandidateSignUpRequest) error {
 	var err error
+	err = s.checkPolicy(&req.UserData)
+	if err != nil {
+		return err
+	}
 	exists, err := s.authRepo.Exists(req.Login)
 	if err != nil {
 		return err
@@ -51,7 +474,7 @@ func (s *authService) CreateCandidate(req *models.CandidateSignUpRequest) error
 	if exists {
 		return models.ErrUsernameExists
 	}
-	req.Password, err = hashAndSalt([]byte(req.Password))
+	req.Password, req.PepperVersion, err = s.passwords.Hash(req.Password)
 	if err != nil {
 		s.logger.Error("could not hash password")
 		return err
@@ -66,6 +489,10 @@ func (s *authService) CreateCandidate(req *models.CandidateSignUpRequest) error
 
 func (s *authService) CreateRecruiter(req *models.RecruiterSignUpRequest) error {
 	var err error
+	err = s.checkPolicy(&req.UserData)
+	if err != nil {
+		return err
+	}
 	exists, err := s.authRepo.Exists(req.Login)
 	if err != nil {
 		return err
@@ -73,7 +500,7 @@ func (s *authService) CreateRecruiter(req *models.RecruiterSignUpRequest) error
 	if exists {
 		return models.ErrUsernameExists
 	}
-	req.Password, err = hashAndSalt([]byte(req.Password))
+	req.Password, req.PepperVersion, err = s.passwords.Hash(req.Password)
 	if err != nil {
 		s.logger.Error("could not hash password")
 		return err
@@ -86,174 +513,270 @@ func (s *authService) CreateRecruiter(req *models.RecruiterSignUpRequest) error
 	return nil
 }
 
-func (s *authService) CandidateLogin(creds *models.UserSignInRequest) (*models.Tokens, error) {
-	pass, userID, err := s.authRepo.GetUserInfoByLogin(creds.Login)
+// checkPolicy - checks the password of a new user against the password policy and returns a models.PolicyViolationError listing the unmet rules.
+// A password that meets the policy but is known from data breaches is rejected with models.ErrPasswordBreached
+func (s *authService) checkPolicy(user *models.UserData) error {
+	violations := s.policy.Check(user.Password, user.Login, user.FirstName, user.LastName)
+	if len(violations) > 0 {
+		return &models.PolicyViolationError{Violations: violations}
+	}
+	breached, err := s.breached.Contains(user.Password)
 	if err != nil {
+		s.logger.Errorf("could not check password against breached passwords: %v", err)
+		return fmt.Errorf("%w could not check password against breached passwords: %v", models.ErrInternalServer, err)
+	}
+	if breached {
+		return models.ErrPasswordBreached
+	}
+	return nil
+}
+
+// passwordChangeRequired - tells whether the password a user signed in with no longer meets the password policy.
+// Only the login is known at sign-in, so passwords containing the name of the user are not detected
+func (s *authService) passwordChangeRequired(creds *models.UserSignInRequest) bool {
+	err := s.checkPolicy(&models.UserData{Login: creds.Login, Password: creds.Password})
+	return errors.Is(err, models.ErrInvalidPasswordFormat) || errors.Is(err, models.ErrPasswordBreached)
+}
+
+func (s *authService) CandidateLogin(creds *models.UserSignInRequest, client *models.ClientInfo) (*models.SignInResult, error) {
+	return s.login(creds, client, models.RoleCandidate)
+}
+
+func (s *authService) RecruiterLogin(creds *models.UserSignInRequest, client *models.ClientInfo) (*models.SignInResult, error) {
+	return s.login(creds, client, models.RoleRecruiter)
+}
+
+// login - signs the user in with a password if the account has the role. Repeated failures for a login or from a client IP
+// block further attempts for a while, so passwords cannot be guessed at speed. Users with two-factor sign-in get
+// an MFA token to send the second factor with instead of tokens
+func (s *authService) login(creds *models.UserSignInRequest, client *models.ClientInfo, role string) (*models.SignInResult, error) {
+	locked, retryAfter, err := s.throttleRepo.Blocked(creds.Login, client.IP)
+	if err != nil {
+		s.logger.Error(err)
 		return nil, err
 	}
-	if !checkPasswordHash(creds.Password, pass) {
-		s.logger.Error("failed to login. Password didn't match")
-		return nil, models.ErrWrongCredential
+	if retryAfter > 0 {
+		return nil, &models.SignInBlockedError{Locked: locked, RetryAfter: retryAfter}
 	}
-	exists, err := s.candidateRepo.Exists(userID)
+
+	stored, err := s.authenticate(creds, role)
 	if err != nil {
+		if errors.Is(err, models.ErrWrongCredential) {
+			s.recordFailure(creds.Login, client)
+		}
 		return nil, err
 	}
-	if !exists {
-		return nil, models.ErrWrongCredential
+	err = s.throttleRepo.ClearFailures(creds.Login)
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	changeRequired := s.passwordChangeRequired(creds)
+	if stored.MFAEnabled && !s.isTrustedDevice(stored.PublicID, client) {
+		return s.startMFAChallenge(stored, role, []string{models.AMRPassword}, changeRequired)
 	}
-	return s.generateTokens(userID, "candidate")
+	tokens, err := s.generateTokens(stored.PublicID, role, []string{models.AMRPassword}, client)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SignInResult{Tokens: tokens, PasswordChangeRequired: changeRequired}, nil
 }
 
-func (s *authService) RecruiterLogin(creds *models.UserSignInRequest) (*models.Tokens, error) {
-	pass, userID, err := s.authRepo.GetUserInfoByLogin(creds.Login)
+// authenticate - returns the credentials of the user if the password is right and the account has the role.
+// An unknown login, a wrong password and a wrong role all fail with models.ErrWrongCredential after a password
+// hash comparison, so neither the response nor its timing tells which logins exist
+func (s *authService) authenticate(creds *models.UserSignInRequest, role string) (*models.Credentials, error) {
+	stored, err := s.authRepo.GetUserInfoByLogin(creds.Login)
 	if err != nil {
+		if errors.Is(err, models.ErrWrongCredential) {
+			s.passwords.VerifyDummy(creds.Password)
+			s.logger.Error("failed to login. Login does not exist")
+		}
 		return nil, err
 	}
-	if !checkPasswordHash(creds.Password, pass) {
+	if !s.checkPassword(creds.Password, stored) {
 		s.logger.Error("failed to login. Password didn't match")
 		return nil, models.ErrWrongCredential
 	}
-	exists, err := s.recruiterRepo.Exists(userID)
-	if err != nil {
-		return nil, err
-	}
-	if !exists {
+	if !stored.HasRole(role) {
+		s.logger.Errorf("failed to login. User is not a %s", role)
 		return nil, models.ErrWrongCredential
 	}
-	return s.generateTokens(userID, "recruiter")
+	return stored, nil
 }
 
-// hashAndSalt - hashes the password with salt. Function takes password as []byte and returns the hash as string and error.
-func hashAndSalt(pwd []byte) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword(pwd, bcrypt.MinCost)
+// recordFailure - counts a failed sign-in, a lockout is recorded as an audit event
+func (s *authService) recordFailure(login string, client *models.ClientInfo) {
+	lockedOut, err := s.throttleRepo.RecordFailure(login, client.IP)
 	if err != nil {
-		return "", err
+		s.logger.Error(err)
+		return
+	}
+	if lockedOut {
+		s.audit.Log(&audit.Event{
+			Type:      audit.AccountLocked,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   map[string]interface{}{"login": login},
+		})
 	}
-	return string(hash), nil
 }
 
-// CheckPasswordHash - checks if the password matches the hash. Function takes password and has as string, and returns true if they matched and false otherwise.
-func checkPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// UnlockLogin - forgets the failed sign-ins of a login, which lifts its lockout
+func (s *authService) UnlockLogin(login, clientID string) error {
+	err := s.throttleRepo.ClearFailures(login)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	s.audit.Log(&audit.Event{
+		Type:    audit.AccountUnlocked,
+		Details: map[string]interface{}{"login": login, "client_id": clientID},
+	})
+	return nil
 }
 
-// CreateAccessToken - function for creating new access token for user
-func createAccessToken(publicID string, tokenTTL time.Duration, tokenSecret string, role string) (*models.Token, error) {
-	var err error
-	//Creating Access Token
-	iat := time.Now().Unix()
-	exp := time.Now().Add(tokenTTL)
-	atClaims := jwt.MapClaims{}
-	atClaims["user_public_id"] = publicID
-	atClaims["iat"] = iat
-	atClaims["exp"] = exp.Unix()
-	atClaims["role"] = role
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	tokenString, err := at.SignedString([]byte(tokenSecret))
+// checkPassword - checks if the password matches the stored hash. A hash made with an outdated algorithm, parameters
+// or pepper is replaced with a fresh one while the plain password is known, failing to do so does not fail the login
+func (s *authService) checkPassword(pass string, stored *models.Credentials) bool {
+	match, needsRehash, err := s.passwords.Verify(pass, stored.PasswordHash, stored.PepperVersion)
 	if err != nil {
-		return nil, err
+		s.logger.Errorf("could not verify password hash of user %s: %v", stored.PublicID, err)
+		return false
 	}
-	token := &models.Token{
-		TokenValue: tokenString,
-		PublicID:   publicID,
-		TTL:        time.Until(exp),
+	if !match {
+		return false
 	}
-	return token, nil
+	if needsRehash {
+		hash, pepperVersion, err := s.passwords.Hash(pass)
+		if err != nil {
+			s.logger.Errorf("could not rehash password of user %s: %v", stored.PublicID, err)
+			return true
+		}
+		if err := s.authRepo.UpdatePassword(stored.PublicID, hash, pepperVersion); err != nil {
+			s.logger.Error(err)
+		}
+	}
+	return true
 }
 
-// CreateRefreshToken - function for creating new refresh token for user
-func createRefreshToken(publicID string, tokenTTL time.Duration, tokenSecret string, role string) (*models.Token, error) {
-	var err error
-	//Creating Refresh Token
-	rtClaims := jwt.MapClaims{}
-	iat := time.Now().Unix()
-	exp := time.Now().Add(tokenTTL)
-	rtClaims["authorized"] = true
-	rtClaims["user_public_id"] = publicID
-	rtClaims["iat"] = iat
-	rtClaims["exp"] = exp.Unix()
-	rtClaims["role"] = role
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	tokenString, err := at.SignedString([]byte(tokenSecret))
+// ParseToken - method that responsible for parsing jwt token. It checks if jwt token is valid and of the expected type, retrieves claims and returns user public id. In case of error returns error
+func (s *authService) parseToken(tokenString string, tokenType string) (*models.Token, error) {
+	token, err := s.tokens.Parse(tokenString, tokenType)
 	if err != nil {
+		s.logger.Error(err)
 		return nil, err
 	}
-	token := &models.Token{
-		TokenValue: tokenString,
-		PublicID:   publicID,
-		TTL:        time.Until(exp),
-	}
 	return token, nil
 }
 
-// ParseToken - method that responsible for parsing jwt token. It checks if jwt token is valid, retrieves claims and returns user public id. In case of error returns error
-func (s *authService) parseToken(tokenString string, tokenSecret string) (*models.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.JwtUserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// RefreshToken - rotates the refresh token of the session it belongs to. Only the latest refresh token of a session is accepted,
+// or the one it replaced for a short grace period, which gets the same successor
+func (s *authService) RefreshToken(tokenString string, client *models.ClientInfo) (*models.Tokens, error) {
+	token, err := s.parseToken(tokenString, models.RefreshTokenType)
 	if err != nil {
 		s.logger.Error(err)
-		return nil, fmt.Errorf("could not parse token: %v %w", err, models.ErrInvalidToken)
-	}
-	if claims, ok := token.Claims.(*models.JwtUserClaims); ok && token.Valid {
-		token := &models.Token{
-			PublicID:   claims.PublicID,
-			TokenValue: tokenString,
-			Role:       claims.Role,
-		}
-		return token, nil
+		return nil, err
 	}
-	return nil, fmt.Errorf("could not parse token: %w", models.ErrInvalidToken)
-}
-
-func (s *authService) RefreshToken(tokenString string) (*models.Tokens, error) {
-	token, err := s.parseToken(tokenString, s.cfg.Token.Refresh.TokenSecret)
+	if token.SessionID == "" || token.ID == "" {
+		s.logger.Error("refresh token has no session")
+		return nil, models.ErrInvalidToken
+	}
+	session := &models.Session{
+		ID:            token.SessionID,
+		PublicID:      token.PublicID,
+		Role:          token.Role,
+		LastRefreshAt: time.Now(),
+		UserAgent:     client.UserAgent,
+		IP:            client.IP,
+		AuthTime:      token.AuthTime,
+		AMR:           token.AMR,
+	}
+	tokens, err := s.issueTokens(session)
 	if err != nil {
-		s.logger.Error(err)
 		return nil, err
 	}
-	redisTokenString, err := s.tokenRepo.GetToken(token.PublicID)
+	rotated, err := s.tokenRepo.RotateSession(session, token.ID, tokens, s.cfg.Token.Refresh.TTL, s.cfg.Token.RefreshGrace)
 	if err != nil {
 		s.logger.Error(err)
+		if errors.Is(err, models.ErrTokenReused) {
+			if err := s.revokeSession(session.ID); err != nil {
+				s.logger.Error(err)
+			}
+			if err := s.forgetDevices(session.PublicID, session.ID); err != nil {
+				s.logger.Error(err)
+			}
+			s.audit.Log(&audit.Event{
+				Type:      audit.RefreshTokenReuse,
+				PublicID:  session.PublicID,
+				SessionID: session.ID,
+				IP:        client.IP,
+				UserAgent: client.UserAgent,
+				Details:   map[string]interface{}{"refresh_token_id": token.ID},
+			})
+		}
 		return nil, err
 	}
-	if tokenString != redisTokenString {
-		s.logger.Errorf("token is unmatched. Wanted %s. Got: %s", tokenString, redisTokenString)
-		return nil, models.ErrTokenExpired
+	if rotated != nil {
+		return s.parseTokens(rotated)
 	}
-	err = s.tokenRepo.UnsetRTToken(token.PublicID)
+	return tokens, nil
+}
+
+// parseTokens - fills in a token pair that only has its token values, e.g. the successor of a refresh token that was
+// rotated concurrently
+func (s *authService) parseTokens(tokens *models.Tokens) (*models.Tokens, error) {
+	accessToken, err := s.parseToken(tokens.AccessToken.TokenValue, models.AccessTokenType)
 	if err != nil {
-		s.logger.Error(err)
 		return nil, err
 	}
-	tokens, err := s.generateTokens(token.PublicID, token.Role)
-
+	refreshToken, err := s.parseToken(tokens.RefreshToken.TokenValue, models.RefreshTokenType)
 	if err != nil {
-		s.logger.Error(err)
 		return nil, err
 	}
-	return tokens, nil
+	return &models.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
-// GenerateTokens - method that responsible for generating tokens. It generates jwt access token and refresh token and returns them as models.Tokenss. In case of error returns error
-func (s *authService) generateTokens(publicID string, role string) (*models.Tokens, error) {
-	accessToken, err := createAccessToken(publicID, s.cfg.Token.Access.TTL, s.cfg.Token.Access.TokenSecret, role)
+// GenerateTokens - method that responsible for generating tokens. It starts a new session for the user, generates jwt access token and refresh token and returns them as models.Tokenss. In case of error returns error.
+// amr tells how the user signed in, the tokens of the session carry it along with the time of the sign-in
+func (s *authService) generateTokens(publicID string, role string, amr []string, client *models.ClientInfo) (*models.Tokens, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:            uuid.NewString(),
+		PublicID:      publicID,
+		Role:          role,
+		CreatedAt:     now,
+		LastRefreshAt: now,
+		UserAgent:     client.UserAgent,
+		IP:            client.IP,
+		AuthTime:      now,
+		AMR:           amr,
+	}
+	tokens, err := s.issueTokens(session)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tokenRepo.CreateSession(session, s.cfg.Token.Refresh.TTL)
 	if err != nil {
 		s.logger.Error(err)
 		return nil, err
 	}
-	refreshToken, err := createRefreshToken(publicID, s.cfg.Token.Refresh.TTL, s.cfg.Token.Refresh.TokenSecret, role)
+	return tokens, nil
+}
+
+// issueTokens - signs a new token pair for the session and stores the id of the new refresh token in session.RefreshTokenID
+func (s *authService) issueTokens(session *models.Session) (*models.Tokens, error) {
+	accessToken, err := s.tokens.AccessToken(session)
 	if err != nil {
 		s.logger.Error(err)
 		return nil, err
 	}
-	err = s.tokenRepo.SetRTToken(refreshToken)
+	refreshToken, err := s.tokens.RefreshToken(session, uuid.NewString())
 	if err != nil {
 		s.logger.Error(err)
 		return nil, err
 	}
+	session.RefreshTokenID = refreshToken.ID
 	tokens := &models.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}
 	return tokens, nil
 }
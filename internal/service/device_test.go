@@ -0,0 +1,124 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/mfa"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+var testPasswordSignIn = &models.UserSignInRequest{Login: testLogin, Password: testPassword}
+
+// enableTOTP - turns two-factor sign-in on for the test user and returns the TOTP secret
+func (e *testEnv) enableTOTP(t *testing.T) string {
+	t.Helper()
+	enrollment, err := e.service.EnrollTOTP(testPublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := mfa.Code(enrollment.Secret, mfa.Step(time.Now())-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.service.EnableTOTP(testPublicID, code); err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret
+}
+
+// signInWithTOTP - signs the test user in with the password and the current TOTP code
+func (e *testEnv) signInWithTOTP(t *testing.T, secret string, rememberDevice bool) *models.SignInResult {
+	t.Helper()
+	result, err := e.service.CandidateLogin(testPasswordSignIn, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MFAToken == "" {
+		t.Fatal("sign-in did not ask for the second factor")
+	}
+	// every sign-in of the test uses the code of the current step, which may be used only once
+	e.users.users[testPublicID].totp.LastUsedStep = 0
+	code, err := mfa.Code(secret, mfa.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = e.service.VerifyMFA(&models.MFASignInRequest{MFAToken: result.MFAToken, Code: code, RememberDevice: rememberDevice}, testClient)
+	if err != nil {
+		t.Fatalf("verify mfa: %v", err)
+	}
+	return result
+}
+
+// skipsSecondFactor - tells whether a password sign-in from the device with the device token is not asked for the second factor
+func (e *testEnv) skipsSecondFactor(t *testing.T, deviceToken string) bool {
+	t.Helper()
+	result, err := e.service.CandidateLogin(testPasswordSignIn, &models.ClientInfo{UserAgent: "go-test", IP: "192.0.2.2", DeviceToken: deviceToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.MFAToken == ""
+}
+
+func TestTrustedDevice(t *testing.T) {
+	env := newTestEnv(t)
+	secret := env.enableTOTP(t)
+
+	if result := env.signInWithTOTP(t, secret, false); result.DeviceToken != "" {
+		t.Fatal("device token issued without remembering the device")
+	}
+	result := env.signInWithTOTP(t, secret, true)
+	if result.DeviceToken == "" {
+		t.Fatal("no device token issued")
+	}
+	for _, key := range env.redis.Keys() {
+		if strings.Contains(key, result.DeviceToken) {
+			t.Fatalf("device token is stored in the clear in %s", key)
+		}
+	}
+	if !env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("remembered device was asked for the second factor")
+	}
+	if env.skipsSecondFactor(t, result.Tokens.AccessToken.TokenValue) {
+		t.Fatal("access token was accepted as device token")
+	}
+
+	env.redis.FastForward(env.service.cfg.MFA.TrustedDeviceTTL - time.Minute)
+	if !env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("device was forgotten before the trusted device TTL")
+	}
+	env.redis.FastForward(2 * time.Minute)
+	if env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("device is trusted after the trusted device TTL")
+	}
+}
+
+func TestTrustedDeviceForgotten(t *testing.T) {
+	env := newTestEnv(t)
+	secret := env.enableTOTP(t)
+
+	result := env.signInWithTOTP(t, secret, true)
+	session := result.Tokens.AccessToken
+	other := env.signInWithTOTP(t, secret, false).Tokens.AccessToken
+	if err := env.service.RevokeSession(testPublicID, other.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if !env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("revoking another session forgot the device")
+	}
+	if err := env.service.RevokeSession(testPublicID, session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("device is trusted after its session was revoked")
+	}
+
+	result = env.signInWithTOTP(t, secret, true)
+	if err := env.service.RevokeAllSessions(testPublicID); err != nil {
+		t.Fatal(err)
+	}
+	if env.skipsSecondFactor(t, result.DeviceToken) {
+		t.Fatal("device is trusted after every session was revoked")
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/mailer"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+// magicCodeDigits is the length of emailed sign-in codes
+const magicCodeDigits = 6
+
+// SendMagicLink - emails a single use sign-in link and code to the candidate with the login. Like ForgotPassword it does
+// not reveal whether the login exists and respects the email limits, the returned error is only meant to be logged
+func (s *authService) SendMagicLink(req *models.MagicLinkRequest, client *models.ClientInfo) error {
+	publicID, email, err := s.authRepo.GetEmailByLogin(req.Login)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return fmt.Errorf("user %s has no email to send a magic link to", publicID)
+	}
+	ok, err := s.hasRole(publicID, models.RoleCandidate)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("user %s is not a candidate, magic links are only sent to candidates", publicID)
+	}
+	err = s.recordEmail(email, client)
+	if err != nil {
+		return err
+	}
+
+	linkToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	code, err := randomCode(magicCodeDigits)
+	if err != nil {
+		return err
+	}
+	err = s.magicLinkRepo.CreateMagicLink(req.Login, hashToken(linkToken), hashToken(code), s.cfg.MagicLink.TTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(&mailer.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Somebody asked to sign in to your account %s.\n\n"+
+			"Follow this link to sign in, it expires in %v and works only once:\n%s%s\n\n"+
+			"Or enter this code: %s\n\n"+
+			"If it was not you, ignore this email.\n",
+			req.Login, s.cfg.MagicLink.TTL, s.cfg.MagicLink.URL, linkToken, code),
+	})
+}
+
+// RedeemMagicLink - signs a candidate in with the token of an emailed link or the emailed code. Wrong codes count as failed
+// sign-ins of the login. The email only stands in for the password, users with two-factor sign-in still get an MFA token
+func (s *authService) RedeemMagicLink(req *models.RedeemMagicLinkRequest, client *models.ClientInfo) (*models.SignInResult, error) {
+	login := req.Login
+	if req.Token != "" {
+		var err error
+		login, err = s.magicLinkRepo.RedeemMagicLink(hashToken(req.Token))
+		if err != nil {
+			s.logger.Error(err)
+			return nil, err
+		}
+	} else {
+		locked, retryAfter, err := s.throttleRepo.Blocked(login, client.IP)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, err
+		}
+		if retryAfter > 0 {
+			return nil, &models.SignInBlockedError{Locked: locked, RetryAfter: retryAfter}
+		}
+		err = s.magicLinkRepo.RedeemMagicCode(login, hashToken(req.Code), s.cfg.MagicLink.MaxAttempts)
+		if err != nil {
+			s.logger.Error(err)
+			if errors.Is(err, models.ErrWrongCredential) {
+				s.recordFailure(login, client)
+			}
+			return nil, err
+		}
+	}
+
+	stored, err := s.authRepo.GetUserInfoByLogin(login)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if !stored.HasRole(models.RoleCandidate) {
+		s.logger.Error("failed to login with magic link. User is not a candidate")
+		return nil, models.ErrWrongCredential
+	}
+	err = s.throttleRepo.ClearFailures(login)
+	if err != nil {
+		s.logger.Error(err)
+	}
+	amr := []string{models.AMREmail}
+	if stored.MFAEnabled && !s.isTrustedDevice(stored.PublicID, client) {
+		return s.startMFAChallenge(stored, models.RoleCandidate, amr, false)
+	}
+	tokens, err := s.generateTokens(stored.PublicID, models.RoleCandidate, amr, client)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SignInResult{Tokens: tokens}, nil
+}
+
+// randomCode - returns a random numeric code with the number of digits
+func randomCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("%w could not generate random code: %v", models.ErrInternalServer, err)
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/audit"
+	"github.com/Zhiyenbek/users-auth-service/internal/mfa"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+// EnrollTOTP - generates a new TOTP secret for the user to set up an authenticator app with. Two-factor sign-in
+// is only enabled once a code of the app is sent to EnableTOTP, until then enrolling again replaces the secret
+func (s *authService) EnrollTOTP(publicID string) (*models.TOTPEnrollment, error) {
+	stored, err := s.authRepo.GetCredentials(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	secret, err := mfa.NewSecret()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	err = s.mfaRepo.CreateTOTP(publicID, secret)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	uri := mfa.URI(s.cfg.MFA.Issuer, stored.Login, secret)
+	qrCode, err := mfa.QRCode(uri)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	return &models.TOTPEnrollment{Secret: secret, URI: uri, QRCode: qrCode}, nil
+}
+
+// EnableTOTP - enables two-factor sign-in once the user proves to have set up the authenticator app with a code of it.
+// It returns the recovery codes of the user, only their hashes are stored so they cannot be shown again
+func (s *authService) EnableTOTP(publicID, code string) ([]string, error) {
+	totp, err := s.mfaRepo.GetTOTP(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if totp.Enabled {
+		return nil, models.ErrMFAAlreadyEnabled
+	}
+	step, ok := mfa.Validate(totp.Secret, code, time.Now(), s.cfg.MFA.Skew)
+	if !ok {
+		return nil, models.ErrInvalidMFACode
+	}
+	codes, err := mfa.NewRecoveryCodes(s.cfg.MFA.RecoveryCodes)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(mfa.NormalizeRecoveryCode(code))
+	}
+	err = s.mfaRepo.EnableTOTP(publicID, step, hashes)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	s.audit.Log(&audit.Event{Type: audit.MFAEnabled, PublicID: publicID})
+	return codes, nil
+}
+
+// startMFAChallenge - holds back the tokens of a sign-in with the right first factor, proven as amr tells, until the
+// second factor is verified
+func (s *authService) startMFAChallenge(stored *models.Credentials, role string, amr []string, changeRequired bool) (*models.SignInResult, error) {
+	mfaToken, err := randomToken()
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	challenge := &models.MFAChallenge{
+		PublicID:               stored.PublicID,
+		Login:                  stored.Login,
+		Role:                   role,
+		AMR:                    amr,
+		PasswordChangeRequired: changeRequired,
+	}
+	err = s.challengeRepo.CreateChallenge(hashToken(mfaToken), challenge, s.cfg.MFA.ChallengeTTL)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	return &models.SignInResult{MFAToken: mfaToken}, nil
+}
+
+// VerifyMFA - finishes a sign-in with the MFA token it returned and a TOTP code or a recovery code. An MFA token is
+// used up by a successful sign-in and dropped after too many wrong codes, which also count as failed sign-ins of the login.
+// If asked to, the device is remembered and gets a device token to skip the second factor with from then on
+func (s *authService) VerifyMFA(req *models.MFASignInRequest, client *models.ClientInfo) (*models.SignInResult, error) {
+	tokenHash := hashToken(req.MFAToken)
+	challenge, err := s.challengeRepo.GetChallenge(tokenHash)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	locked, retryAfter, err := s.throttleRepo.Blocked(challenge.Login, client.IP)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &models.SignInBlockedError{Locked: locked, RetryAfter: retryAfter}
+	}
+
+	ok, err := s.checkSecondFactor(challenge.PublicID, req, client)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.recordFailure(challenge.Login, client)
+		dropped, err := s.challengeRepo.FailChallenge(tokenHash, s.cfg.MFA.MaxAttempts)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, err
+		}
+		if dropped {
+			return nil, models.ErrInvalidToken
+		}
+		return nil, models.ErrInvalidMFACode
+	}
+
+	err = s.challengeRepo.DeleteChallenge(tokenHash)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	err = s.throttleRepo.ClearFailures(challenge.Login)
+	if err != nil {
+		s.logger.Error(err)
+	}
+	amr := append(challenge.AMR, models.AMROTP, models.AMRMultiFactor)
+	tokens, err := s.generateTokens(challenge.PublicID, challenge.Role, amr, client)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SignInResult{Tokens: tokens, PasswordChangeRequired: challenge.PasswordChangeRequired}
+	if req.RememberDevice {
+		result.DeviceToken, err = s.rememberDevice(tokens.AccessToken, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// rememberDevice - trusts the device of a sign-in with the second factor and returns the device token it will show.
+// The token is random and only its hash is stored, it stays valid for the trusted device TTL whatever signing keys rotate
+func (s *authService) rememberDevice(accessToken *models.Token, client *models.ClientInfo) (string, error) {
+	deviceToken, err := randomToken()
+	if err != nil {
+		s.logger.Error(err)
+		return "", err
+	}
+	device := &models.TrustedDevice{
+		TokenHash: hashToken(deviceToken),
+		PublicID:  accessToken.PublicID,
+		SessionID: accessToken.SessionID,
+		CreatedAt: time.Now(),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+	}
+	err = s.deviceRepo.CreateDevice(device, s.cfg.MFA.TrustedDeviceTTL)
+	if err != nil {
+		s.logger.Error(err)
+		return "", err
+	}
+	return deviceToken, nil
+}
+
+// isTrustedDevice - tells whether the client shows the device token of a device the user trusts. The device is stored
+// for the user, so the token is useless to anybody else and after the device was forgotten
+func (s *authService) isTrustedDevice(publicID string, client *models.ClientInfo) bool {
+	if client.DeviceToken == "" {
+		return false
+	}
+	trusted, err := s.deviceRepo.IsTrustedDevice(publicID, hashToken(client.DeviceToken))
+	if err != nil {
+		s.logger.Error(err)
+		return false
+	}
+	return trusted
+}
+
+// forgetDevices - makes the devices remembered in the session, or every device of the user for an empty session id,
+// pass the second factor again
+func (s *authService) forgetDevices(publicID, sessionID string) error {
+	err := s.deviceRepo.DeleteDevices(publicID, sessionID)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// checkSecondFactor - checks the TOTP code or, if there is none, the recovery code of the request. Either of them
+// can only be used once
+func (s *authService) checkSecondFactor(publicID string, req *models.MFASignInRequest, client *models.ClientInfo) (bool, error) {
+	if req.Code == "" {
+		used, err := s.mfaRepo.UseRecoveryCode(publicID, hashToken(mfa.NormalizeRecoveryCode(req.RecoveryCode)))
+		if err != nil {
+			s.logger.Error(err)
+			return false, err
+		}
+		if used {
+			s.audit.Log(&audit.Event{
+				Type:      audit.RecoveryCodeUsed,
+				PublicID:  publicID,
+				IP:        client.IP,
+				UserAgent: client.UserAgent,
+			})
+		}
+		return used, nil
+	}
+
+	totp, err := s.mfaRepo.GetTOTP(publicID)
+	if err != nil {
+		if errors.Is(err, models.ErrMFANotEnrolled) {
+			return false, nil
+		}
+		s.logger.Error(err)
+		return false, err
+	}
+	step, ok := mfa.Validate(totp.Secret, req.Code, time.Now(), s.cfg.MFA.Skew)
+	if !ok {
+		return false, nil
+	}
+	used, err := s.mfaRepo.UseTOTPStep(publicID, step)
+	if err != nil {
+		s.logger.Error(err)
+		return false, err
+	}
+	if !used {
+		s.logger.Errorf("TOTP code of user %s was already used", publicID)
+	}
+	return used, nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/audit"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/Zhiyenbek/users-auth-service/internal/passkey"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// BeginPasskeyRegistration - starts the registration of a passkey for a signed in user. The returned options are
+// passed to navigator.credentials.create by the frontend
+func (s *authService) BeginPasskeyRegistration(publicID string) (*protocol.CredentialCreation, error) {
+	user, err := s.passkeyUser(publicID)
+	if err != nil {
+		return nil, err
+	}
+	creation, session, err := s.webAuthn.BeginRegistration(user, webauthn.WithExclusions(user.Exclusions()))
+	if err != nil {
+		s.logger.Errorf("could not begin passkey registration of user %s: %v", publicID, err)
+		return nil, fmt.Errorf("%w could not begin passkey registration: %v", models.ErrInternalServer, err)
+	}
+	err = s.saveCeremony(session, &models.PasskeyCeremony{PublicID: publicID})
+	if err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+// FinishPasskeyRegistration - verifies the response of the authenticator and stores the new passkey of the user
+func (s *authService) FinishPasskeyRegistration(publicID string, response *protocol.ParsedCredentialCreationData) error {
+	ceremony, session, err := s.takeCeremony(response.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return err
+	}
+	if ceremony.PublicID != publicID {
+		s.logger.Errorf("passkey registration of user %s was finished by user %s", ceremony.PublicID, publicID)
+		return models.ErrInvalidPasskey
+	}
+	user, err := s.passkeyUser(publicID)
+	if err != nil {
+		return err
+	}
+	credential, err := s.webAuthn.CreateCredential(user, *session, response)
+	if err != nil {
+		s.logger.Errorf("could not verify passkey registration of user %s: %v", publicID, err)
+		return fmt.Errorf("%w: %v", models.ErrInvalidPasskey, err)
+	}
+	err = s.passkeyRepo.CreatePasskey(publicID, passkey.FromCredential(credential))
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	s.audit.Log(&audit.Event{Type: audit.PasskeyRegistered, PublicID: publicID})
+	return nil
+}
+
+// BeginPasskeySignIn - starts a passwordless sign-in. The returned options are passed to navigator.credentials.get by
+// the frontend, which lets the user pick any passkey registered for the service
+func (s *authService) BeginPasskeySignIn(role string) (*protocol.CredentialAssertion, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		s.logger.Errorf("could not begin passkey sign-in: %v", err)
+		return nil, fmt.Errorf("%w could not begin passkey sign-in: %v", models.ErrInternalServer, err)
+	}
+	err = s.saveCeremony(session, &models.PasskeyCeremony{Role: role})
+	if err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishPasskeySignIn - verifies the response of the authenticator and signs the user in if the account has the role.
+// A passkey proves both possession and, through user verification, the PIN or biometrics of the user, so it is not
+// followed by a second factor. A signature counter that did not increase rejects the sign-in as the passkey was cloned
+func (s *authService) FinishPasskeySignIn(role string, response *protocol.ParsedCredentialAssertionData, client *models.ClientInfo) (*models.SignInResult, error) {
+	ceremony, session, err := s.takeCeremony(response.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.Role != role {
+		s.logger.Errorf("passkey sign-in as %s was finished as %s", ceremony.Role, role)
+		return nil, models.ErrInvalidPasskey
+	}
+
+	var user *passkey.User
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		user, err = s.passkeyUser(string(userHandle))
+		return user, err
+	}, *session, response)
+	if err != nil {
+		s.logger.Errorf("could not verify passkey sign-in: %v", err)
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidPasskey, err)
+	}
+	ok, err := s.hasRole(user.PublicID, role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.logger.Errorf("failed to login with passkey. User is not a %s", role)
+		return nil, models.ErrInvalidPasskey
+	}
+
+	used := false
+	if !credential.Authenticator.CloneWarning {
+		used, err = s.passkeyRepo.UsePasskey(credential.ID, credential.Authenticator.SignCount)
+		if err != nil {
+			s.logger.Error(err)
+			return nil, err
+		}
+	}
+	if !used {
+		s.audit.Log(&audit.Event{
+			Type:      audit.PasskeyCloned,
+			PublicID:  user.PublicID,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   map[string]interface{}{"sign_count": credential.Authenticator.SignCount},
+		})
+		return nil, models.ErrInvalidPasskey
+	}
+
+	tokens, err := s.generateTokens(user.PublicID, role, []string{models.AMRHardwareKey}, client)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SignInResult{Tokens: tokens}, nil
+}
+
+// passkeyUser - returns the user with the public id together with the passkeys of the user
+func (s *authService) passkeyUser(publicID string) (*passkey.User, error) {
+	stored, err := s.authRepo.GetCredentials(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	passkeys, err := s.passkeyRepo.GetPasskeys(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	return &passkey.User{PublicID: publicID, Login: stored.Login, Passkeys: passkeys}, nil
+}
+
+// hasRole - tells whether the user with the public id has the role
+func (s *authService) hasRole(publicID, role string) (bool, error) {
+	var ok bool
+	var err error
+	switch role {
+	case models.RoleCandidate:
+		ok, err = s.candidateRepo.Exists(publicID)
+	case models.RoleRecruiter:
+		ok, err = s.recruiterRepo.Exists(publicID)
+	}
+	if err != nil {
+		s.logger.Error(err)
+		return false, err
+	}
+	return ok, nil
+}
+
+// saveCeremony - stores the state of a WebAuthn ceremony until the authenticator responds
+func (s *authService) saveCeremony(session *webauthn.SessionData, ceremony *models.PasskeyCeremony) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		s.logger.Errorf("could not encode WebAuthn session: %v", err)
+		return fmt.Errorf("%w could not encode WebAuthn session: %v", models.ErrInternalServer, err)
+	}
+	ceremony.Session = data
+	err = s.ceremonyRepo.CreateCeremony(session.Challenge, ceremony, s.cfg.WebAuthn.Timeout)
+	if err != nil {
+		s.logger.Error(err)
+		return err
+	}
+	return nil
+}
+
+// takeCeremony - returns the WebAuthn ceremony of the challenge the authenticator responded to, a challenge can only be answered once
+func (s *authService) takeCeremony(challenge string) (*models.PasskeyCeremony, *webauthn.SessionData, error) {
+	ceremony, err := s.ceremonyRepo.TakeCeremony(challenge)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, nil, err
+	}
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal(ceremony.Session, session); err != nil {
+		s.logger.Errorf("could not decode WebAuthn session: %v", err)
+		return nil, nil, fmt.Errorf("%w could not decode WebAuthn session: %v", models.ErrInternalServer, err)
+	}
+	return ceremony, session, nil
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// authenticator data flags, see https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator - a passkey kept in memory. It answers WebAuthn ceremonies like a platform authenticator with a
+// P-256 key, without attestation, reporting counter as its signature counter
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID, counter: 1}
+}
+
+// authenticatorData - the RP ID hash, the flags and the signature counter, followed by the attested credential
+// data on registration
+func (a *softAuthenticator) authenticatorData(t *testing.T, flags byte, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte("localhost"))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if !attested {
+		return data
+	}
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, publicKey...)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremonyType string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"type": ceremonyType, "challenge": challenge.String(), "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Create - answers navigator.credentials.create with a new passkey
+func (a *softAuthenticator) Create(t *testing.T, options *protocol.CredentialCreation) *protocol.ParsedCredentialCreationData {
+	t.Helper()
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(t, flagUserPresent|flagUserVerified|flagAttestedCredential, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData(t, "webauthn.create", options.Response.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// Get - answers navigator.credentials.get, signing with the current counter
+func (a *softAuthenticator) Get(t *testing.T, options *protocol.CredentialAssertion) *protocol.ParsedCredentialAssertionData {
+	t.Helper()
+	authData := a.authenticatorData(t, flagUserPresent|flagUserVerified, false)
+	clientData := a.clientData(t, "webauthn.get", options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// registerPasskey - registers a new passkey for the test user
+func (e *testEnv) registerPasskey(t *testing.T) *softAuthenticator {
+	t.Helper()
+	authenticator := newSoftAuthenticator(t)
+	options, err := e.service.BeginPasskeyRegistration(testPublicID)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	err = e.service.FinishPasskeyRegistration(testPublicID, authenticator.Create(t, options))
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	return authenticator
+}
+
+// passkeySignIn - signs the test user in as a candidate with the authenticator
+func (e *testEnv) passkeySignIn(t *testing.T, authenticator *softAuthenticator) (*models.SignInResult, error) {
+	t.Helper()
+	options, err := e.service.BeginPasskeySignIn(models.RoleCandidate)
+	if err != nil {
+		t.Fatalf("begin sign-in: %v", err)
+	}
+	return e.service.FinishPasskeySignIn(models.RoleCandidate, authenticator.Get(t, options), testClient)
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	env := newTestEnv(t)
+	authenticator := newSoftAuthenticator(t)
+	options, err := env.service.BeginPasskeyRegistration(testPublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := authenticator.Create(t, options)
+	err = env.service.FinishPasskeyRegistration(testPublicID, response)
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	passkeys := env.passkeys.passkeys[testPublicID]
+	if len(passkeys) != 1 || !bytes.Equal(passkeys[0].CredentialID, authenticator.credentialID) {
+		t.Fatalf("stored passkeys: %+v", passkeys)
+	}
+
+	err = env.service.FinishPasskeyRegistration(testPublicID, response)
+	if !errors.Is(err, models.ErrInvalidPasskey) {
+		t.Fatalf("replayed registration: got %v, want %v", err, models.ErrInvalidPasskey)
+	}
+	options, err = env.service.BeginPasskeyRegistration(testPublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Response.CredentialExcludeList) != 1 {
+		t.Fatalf("registered passkeys are not excluded: %+v", options.Response.CredentialExcludeList)
+	}
+}
+
+func TestPasskeyRegistrationFinishedByAnotherUser(t *testing.T) {
+	env := newTestEnv(t)
+	options, err := env.service.BeginPasskeyRegistration(testPublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.service.FinishPasskeyRegistration("another-user", newSoftAuthenticator(t).Create(t, options))
+	if !errors.Is(err, models.ErrInvalidPasskey) {
+		t.Fatalf("got %v, want %v", err, models.ErrInvalidPasskey)
+	}
+}
+
+func TestPasskeySignIn(t *testing.T) {
+	env := newTestEnv(t)
+	authenticator := env.registerPasskey(t)
+
+	authenticator.counter++
+	result, err := env.passkeySignIn(t, authenticator)
+	if err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+	if result.Tokens == nil || result.MFAToken != "" {
+		t.Fatalf("passkey sign-in did not issue tokens: %+v", result)
+	}
+	amr := result.Tokens.AccessToken.AMR
+	if len(amr) != 1 || amr[0] != models.AMRHardwareKey {
+		t.Fatalf("amr = %v, want [%s]", amr, models.AMRHardwareKey)
+	}
+	if stored := env.passkeys.passkeys[testPublicID][0].SignCount; stored != authenticator.counter {
+		t.Fatalf("stored sign count = %d, want %d", stored, authenticator.counter)
+	}
+}
+
+func TestPasskeySignInRejectsReplayedResponse(t *testing.T) {
+	env := newTestEnv(t)
+	authenticator := env.registerPasskey(t)
+
+	options, err := env.service.BeginPasskeySignIn(models.RoleCandidate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.counter++
+	response := authenticator.Get(t, options)
+	_, err = env.service.FinishPasskeySignIn(models.RoleCandidate, response, testClient)
+	if err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+	_, err = env.service.FinishPasskeySignIn(models.RoleCandidate, response, testClient)
+	if !errors.Is(err, models.ErrInvalidPasskey) {
+		t.Fatalf("replayed response: got %v, want %v", err, models.ErrInvalidPasskey)
+	}
+}
+
+func TestPasskeySignInRejectsSignCountThatDidNotIncrease(t *testing.T) {
+	env := newTestEnv(t)
+	authenticator := env.registerPasskey(t)
+	authenticator.counter = 5
+	if _, err := env.passkeySignIn(t, authenticator); err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+
+	for _, counter := range []uint32{5, 3} {
+		authenticator.counter = counter
+		_, err := env.passkeySignIn(t, authenticator)
+		if !errors.Is(err, models.ErrInvalidPasskey) {
+			t.Fatalf("sign count %d after 5: got %v, want %v", counter, err, models.ErrInvalidPasskey)
+		}
+	}
+	if stored := env.passkeys.passkeys[testPublicID][0].SignCount; stored != 5 {
+		t.Fatalf("stored sign count = %d, want 5", stored)
+	}
+}
+
+func TestPasskeySignInRejectsConcurrentClone(t *testing.T) {
+	env := newTestEnv(t)
+	authenticator := env.registerPasskey(t)
+
+	// a clone signs in with a higher counter after the counter was read but before it was recorded
+	env.passkeys.beforeUse = func() {
+		_, err := env.passkeys.UsePasskey(authenticator.credentialID, 10)
+		if err != nil {
+			t.Errorf("sign in with the clone: %v", err)
+		}
+	}
+	authenticator.counter = 2
+	_, err := env.passkeySignIn(t, authenticator)
+	if !errors.Is(err, models.ErrInvalidPasskey) {
+		t.Fatalf("got %v, want %v", err, models.ErrInvalidPasskey)
+	}
+	if stored := env.passkeys.passkeys[testPublicID][0].SignCount; stored != 10 {
+		t.Fatalf("stored sign count = %d, want 10", stored)
+	}
+}
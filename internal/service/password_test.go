@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+const testNewPassword = "N3w-Passw0rd!"
+
+// forgotPassword - asks for a reset link for the test user and returns the token of the emailed link
+func (e *testEnv) forgotPassword(t *testing.T) string {
+	t.Helper()
+	err := e.service.ForgotPassword(&models.ForgotPasswordRequest{Login: testLogin}, testClient)
+	if err != nil {
+		t.Fatalf("forgot password: %v", err)
+	}
+	msg := e.smtp.Receive(t)
+	if len(msg.To) != 1 || msg.To[0] != testEmail {
+		t.Fatalf("reset link was sent to %v, want %s", msg.To, testEmail)
+	}
+	prefix := e.service.cfg.Password.Reset.URL
+	link := msg.Link(prefix)
+	if link == "" {
+		t.Fatalf("email has no reset link:\n%s", msg.Data)
+	}
+	return strings.TrimPrefix(link, prefix)
+}
+
+func TestForgotPasswordSendsResetLink(t *testing.T) {
+	env := newTestEnv(t)
+	resetToken := env.forgotPassword(t)
+	if resetToken == "" {
+		t.Fatal("reset link has no token")
+	}
+
+	err := env.service.ForgotPassword(&models.ForgotPasswordRequest{Login: "nobody"}, testClient)
+	if err == nil {
+		t.Fatal("reset link was sent to a login that does not exist")
+	}
+	env.smtp.NoMessage(t)
+}
+
+func TestResetPasswordLinkWorksOnce(t *testing.T) {
+	env := newTestEnv(t)
+	resetToken := env.forgotPassword(t)
+
+	err := env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: testNewPassword})
+	if err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	_, err = env.service.CandidateLogin(&models.UserSignInRequest{Login: testLogin, Password: testNewPassword}, testClient)
+	if err != nil {
+		t.Fatalf("sign in with the new password: %v", err)
+	}
+	_, err = env.service.CandidateLogin(&models.UserSignInRequest{Login: testLogin, Password: testPassword}, testClient)
+	if !errors.Is(err, models.ErrWrongCredential) {
+		t.Fatalf("sign in with the old password: got %v, want %v", err, models.ErrWrongCredential)
+	}
+
+	err = env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: "An0ther-Passw0rd!"})
+	if !errors.Is(err, models.ErrInvalidToken) {
+		t.Fatalf("second use of the reset link: got %v, want %v", err, models.ErrInvalidToken)
+	}
+}
+
+func TestResetPasswordLinkKeptOnRejectedPassword(t *testing.T) {
+	env := newTestEnv(t)
+	resetToken := env.forgotPassword(t)
+
+	err := env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: testPassword})
+	if err == nil {
+		t.Fatal("the current password was accepted as the new one")
+	}
+	err = env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: testNewPassword})
+	if err != nil {
+		t.Fatalf("retry with a valid password: %v", err)
+	}
+}
+
+func TestResetPasswordLinkExpires(t *testing.T) {
+	env := newTestEnv(t)
+	resetToken := env.forgotPassword(t)
+
+	env.redis.FastForward(env.service.cfg.Password.Reset.TTL + time.Second)
+	err := env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: testNewPassword})
+	if !errors.Is(err, models.ErrInvalidToken) {
+		t.Fatalf("expired reset link: got %v, want %v", err, models.ErrInvalidToken)
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	env := newTestEnv(t)
+	tokens := env.signIn(t)
+	resetToken := env.forgotPassword(t)
+
+	err := env.service.ResetPassword(&models.ResetPasswordRequest{Token: resetToken, NewPassword: testNewPassword})
+	if err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	revoked, err := env.service.IsRevoked(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("access token of a session started before the reset is not revoked")
+	}
+	_, err = env.service.RefreshToken(tokens.RefreshToken.TokenValue, testClient)
+	if err == nil {
+		t.Fatal("refresh token of a session started before the reset still works")
+	}
+	sessions, err := env.service.ListSessions(testPublicID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("%d sessions left after the reset", len(sessions))
+	}
+}
+
+func TestForgotPasswordEmailLimits(t *testing.T) {
+	env := newTestEnv(t)
+	limits := env.service.cfg.Throttle.Email
+	for i := 0; i < limits.PerAddress; i++ {
+		env.forgotPassword(t)
+	}
+	err := env.service.ForgotPassword(&models.ForgotPasswordRequest{Login: testLogin}, &models.ClientInfo{IP: "198.51.100.1"})
+	if !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Fatalf("email past the limit of the address: got %v, want %v", err, models.ErrTooManyAttempts)
+	}
+	err = env.service.SendMagicLink(&models.MagicLinkRequest{Login: testLogin}, &models.ClientInfo{IP: "198.51.100.1"})
+	if !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Fatalf("magic link past the limit of the address: got %v, want %v", err, models.ErrTooManyAttempts)
+	}
+	env.smtp.NoMessage(t)
+
+	env.redis.FastForward(limits.Window)
+	env.forgotPassword(t)
+}
+
+func TestForgotPasswordEmailLimitsPerIP(t *testing.T) {
+	env := newTestEnv(t)
+	limits := env.service.cfg.Throttle.Email
+	for i := 0; i < limits.PerIP; i++ {
+		env.users.add(fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i))
+		err := env.service.ForgotPassword(&models.ForgotPasswordRequest{Login: fmt.Sprintf("user%d", i)}, testClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.smtp.Receive(t)
+	}
+	err := env.service.ForgotPassword(&models.ForgotPasswordRequest{Login: testLogin}, testClient)
+	if !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Fatalf("email past the limit of the IP: got %v, want %v", err, models.ErrTooManyAttempts)
+	}
+	env.smtp.NoMessage(t)
+
+	err = env.service.ForgotPassword(&models.ForgotPasswordRequest{Login: testLogin}, &models.ClientInfo{IP: "198.51.100.1"})
+	if err != nil {
+		t.Fatalf("email asked for from another IP: %v", err)
+	}
+	env.smtp.Receive(t)
+}
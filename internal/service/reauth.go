@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/audit"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+// Reauthenticate - proves again who the user of the session is and issues a short-lived access token with a fresh
+// auth_time for sensitive operations. The password, a second factor or both are accepted, but users with two-factor
+// sign-in have to send a second factor. Wrong ones count as failed sign-ins of the login
+func (s *authService) Reauthenticate(publicID, sessionID, role string, req *models.ReauthenticateRequest, client *models.ClientInfo) (*models.Token, error) {
+	stored, err := s.authRepo.GetCredentials(publicID)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	locked, retryAfter, err := s.throttleRepo.Blocked(stored.Login, client.IP)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &models.SignInBlockedError{Locked: locked, RetryAfter: retryAfter}
+	}
+	mfaEnabled := false
+	totp, err := s.mfaRepo.GetTOTP(publicID)
+	if err == nil {
+		mfaEnabled = totp.Enabled
+	} else if !errors.Is(err, models.ErrMFANotEnrolled) {
+		s.logger.Error(err)
+		return nil, err
+	}
+
+	var amr []string
+	if req.Password != "" {
+		if !s.checkPassword(req.Password, stored) {
+			s.logger.Errorf("failed to reauthenticate user %s. Password didn't match", publicID)
+			s.recordFailure(stored.Login, client)
+			return nil, models.ErrWrongCredential
+		}
+		amr = append(amr, models.AMRPassword)
+	}
+	if req.Code != "" || req.RecoveryCode != "" {
+		ok, err := s.checkSecondFactor(publicID, &models.MFASignInRequest{Code: req.Code, RecoveryCode: req.RecoveryCode}, client)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			s.logger.Errorf("failed to reauthenticate user %s. Second factor is wrong", publicID)
+			s.recordFailure(stored.Login, client)
+			return nil, models.ErrInvalidMFACode
+		}
+		amr = append(amr, models.AMROTP)
+	} else if mfaEnabled {
+		return nil, models.ErrInvalidMFACode
+	}
+	if len(amr) == 0 {
+		return nil, models.ErrWrongCredential
+	}
+	if len(amr) > 1 {
+		amr = append(amr, models.AMRMultiFactor)
+	}
+	err = s.throttleRepo.ClearFailures(stored.Login)
+	if err != nil {
+		s.logger.Error(err)
+	}
+
+	session := &models.Session{ID: sessionID, PublicID: publicID, Role: role, AuthTime: time.Now(), AMR: amr}
+	token, err := s.tokens.ElevatedToken(session)
+	if err != nil {
+		s.logger.Error(err)
+		return nil, err
+	}
+	s.audit.Log(&audit.Event{
+		Type:      audit.Reauthenticated,
+		PublicID:  publicID,
+		SessionID: sessionID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   map[string]interface{}{"amr": amr},
+	})
+	return token, nil
+}
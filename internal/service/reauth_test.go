@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+func TestRevokedSessionDeniesElevatedToken(t *testing.T) {
+	revocations := []struct {
+		name   string
+		revoke func(t *testing.T, env *testEnv, tokens *models.Tokens) error
+	}{
+		{"revoke session", func(t *testing.T, env *testEnv, tokens *models.Tokens) error {
+			return env.service.RevokeSession(testPublicID, tokens.AccessToken.SessionID)
+		}},
+		{"revoke all sessions", func(t *testing.T, env *testEnv, _ *models.Tokens) error {
+			return env.service.RevokeAllSessions(testPublicID)
+		}},
+		{"change password", func(t *testing.T, env *testEnv, _ *models.Tokens) error {
+			// signs out every other session, the elevated token belongs to one of them
+			current := env.signIn(t).AccessToken
+			return env.service.ChangePassword(testPublicID, current.SessionID,
+				&models.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: testNewPassword}, testClient)
+		}},
+		{"refresh token reuse", func(t *testing.T, env *testEnv, tokens *models.Tokens) error {
+			if _, err := env.service.RefreshToken(tokens.RefreshToken.TokenValue, testClient); err != nil {
+				return err
+			}
+			_, err := env.service.RefreshToken(tokens.RefreshToken.TokenValue, testClient)
+			if !errors.Is(err, models.ErrTokenReused) {
+				t.Fatalf("reused refresh token: got %v, want %v", err, models.ErrTokenReused)
+			}
+			return nil
+		}},
+	}
+	for _, revocation := range revocations {
+		t.Run(revocation.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.service.cfg.Token.StepUp.TTL = 2 * env.service.cfg.Token.Access.TTL
+
+			tokens := env.signIn(t)
+			session := tokens.AccessToken
+			elevated, err := env.service.Reauthenticate(testPublicID, session.SessionID, session.Role,
+				&models.ReauthenticateRequest{Password: testPassword}, testClient)
+			if err != nil {
+				t.Fatalf("reauthenticate: %v", err)
+			}
+			if err := revocation.revoke(t, env, tokens); err != nil {
+				t.Fatal(err)
+			}
+
+			// past the lifetime of a regular access token, but not of the elevated one
+			env.redis.FastForward(env.service.cfg.Token.Access.TTL + time.Minute)
+			if !env.isRevokedElsewhere(t, elevated) {
+				t.Fatal("elevated token of a revoked session is accepted once regular access tokens expired")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+)
+
+func TestRevokedTokenRejectedWithinLeeway(t *testing.T) {
+	revocations := []struct {
+		name   string
+		revoke func(env *testEnv, tokens *models.Tokens) error
+	}{
+		{"sign out", func(env *testEnv, tokens *models.Tokens) error {
+			return env.service.SignOut(tokens.AccessToken.TokenValue)
+		}},
+		{"revoke access token", func(env *testEnv, tokens *models.Tokens) error {
+			return env.service.RevokeToken(tokens.AccessToken.TokenValue, "")
+		}},
+		{"revoke refresh token", func(env *testEnv, tokens *models.Tokens) error {
+			return env.service.RevokeToken(tokens.RefreshToken.TokenValue, models.RefreshTokenHint)
+		}},
+		{"revoke session", func(env *testEnv, tokens *models.Tokens) error {
+			return env.service.RevokeSession(testPublicID, tokens.AccessToken.SessionID)
+		}},
+	}
+	for _, revocation := range revocations {
+		t.Run(revocation.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			tokens := env.signIn(t)
+			if err := revocation.revoke(env, tokens); err != nil {
+				t.Fatal(err)
+			}
+
+			// the parser still accepts the token until exp + leeway
+			accepted := time.Until(tokens.AccessToken.ExpiresAt) + env.service.cfg.Token.Leeway
+			env.redis.FastForward(accepted - time.Second)
+			if !env.isRevokedElsewhere(t, tokens.AccessToken) {
+				t.Fatal("revoked token is accepted within the leeway past its expiry")
+			}
+		})
+	}
+}
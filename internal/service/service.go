@@ -2,26 +2,51 @@ package service
 
 import (
 	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/mailer"
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/Zhiyenbek/users-auth-service/internal/password"
 	"github.com/Zhiyenbek/users-auth-service/internal/repository"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"go.uber.org/zap"
 )
 
 type AuthService interface {
-	CandidateLogin(creds *models.UserSignInRequest) (*models.Tokens, error)
-	RecruiterLogin(creds *models.UserSignInRequest) (*models.Tokens, error)
-	RefreshToken(tokenString string) (*models.Tokens, error)
+	CandidateLogin(creds *models.UserSignInRequest, client *models.ClientInfo) (*models.SignInResult, error)
+	RecruiterLogin(creds *models.UserSignInRequest, client *models.ClientInfo) (*models.SignInResult, error)
+	RefreshToken(tokenString string, client *models.ClientInfo) (*models.Tokens, error)
 	CreateRecruiter(req *models.RecruiterSignUpRequest) error
 	CreateCandidate(req *models.CandidateSignUpRequest) error
 	SignOut(accessToken string) error
+	IsRevoked(token *models.Token) (bool, error)
+	Introspect(tokenString, tokenTypeHint string) (*models.IntrospectionResponse, error)
+	RevokeToken(tokenString, tokenTypeHint string) error
+	ListSessions(publicID string) ([]*models.Session, error)
+	RevokeSession(publicID, sessionID string) error
+	RevokeAllSessions(publicID string) error
+	ChangePassword(publicID, sessionID string, req *models.ChangePasswordRequest, client *models.ClientInfo) error
+	ForgotPassword(req *models.ForgotPasswordRequest, client *models.ClientInfo) error
+	ResetPassword(req *models.ResetPasswordRequest) error
+	UnlockLogin(login, clientID string) error
+	EnrollTOTP(publicID string) (*models.TOTPEnrollment, error)
+	EnableTOTP(publicID, code string) ([]string, error)
+	VerifyMFA(req *models.MFASignInRequest, client *models.ClientInfo) (*models.SignInResult, error)
+	BeginPasskeyRegistration(publicID string) (*protocol.CredentialCreation, error)
+	FinishPasskeyRegistration(publicID string, response *protocol.ParsedCredentialCreationData) error
+	BeginPasskeySignIn(role string) (*protocol.CredentialAssertion, error)
+	FinishPasskeySignIn(role string, response *protocol.ParsedCredentialAssertionData, client *models.ClientInfo) (*models.SignInResult, error)
+	SendMagicLink(req *models.MagicLinkRequest, client *models.ClientInfo) error
+	RedeemMagicLink(req *models.RedeemMagicLinkRequest, client *models.ClientInfo) (*models.SignInResult, error)
+	Reauthenticate(publicID, sessionID, role string, req *models.ReauthenticateRequest, client *models.ClientInfo) (*models.Token, error)
 }
 
 type Service struct {
 	AuthService
 }
 
-func New(repos *repository.Repository, log *zap.SugaredLogger, cfg *config.Configs) *Service {
+func New(repos *repository.Repository, tokens *token.Manager, passwords *password.Hasher, breached password.BreachList, mail mailer.Mailer, webAuthn *webauthn.WebAuthn, log *zap.SugaredLogger, cfg *config.Configs) *Service {
 	return &Service{
-		AuthService: NewAuthService(repos, cfg, log),
+		AuthService: NewAuthService(repos, tokens, passwords, breached, mail, webAuthn, cfg, log),
 	}
 }
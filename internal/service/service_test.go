@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
+	"github.com/Zhiyenbek/users-auth-service/internal/mailer"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/Zhiyenbek/users-auth-service/internal/passkey"
+	"github.com/Zhiyenbek/users-auth-service/internal/password"
+	"github.com/Zhiyenbek/users-auth-service/internal/repository"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"go.uber.org/zap"
+)
+
+const (
+	testPublicID = "6f1c1c4e-2b7a-4d0e-9c43-1d1f0f6a2b10"
+	testLogin    = "jdoe"
+	testEmail    = "jdoe@example.com"
+	testPassword = "0ld-Passw0rd!"
+	testOrigin   = "http://localhost:3000"
+)
+
+var testClient = &models.ClientInfo{UserAgent: "go-test", IP: "192.0.2.1"}
+
+// testEnv - an auth service on an in-memory redis, with the postgres repositories faked and emails delivered to an
+// in-process SMTP server
+type testEnv struct {
+	service  *authService
+	redis    *miniredis.Miniredis
+	users    *fakeUsers
+	passkeys *fakePasskeys
+	smtp     *smtpServer
+}
+
+func testConfig(smtpPort int) *config.Configs {
+	return &config.Configs{
+		Token: &config.Token{
+			Issuer:  "users-auth-service",
+			Leeway:  30 * time.Second,
+			Access:  &config.TokenConf{TTL: 15 * time.Minute},
+			Refresh: &config.TokenConf{TTL: time.Hour},
+			Signing: &config.SigningConf{
+				AllowEphemeral: true,
+				Keys:           []*config.SigningKeyConf{{ID: "test", Algorithm: keys.AlgEdDSA}},
+			},
+			Revocation: &config.RevocationConf{CacheTTL: time.Second},
+			StepUp:     &config.StepUpConf{TTL: 5 * time.Minute, MaxAge: 10 * time.Minute},
+		},
+		Password: &config.PasswordConf{
+			Algorithm:   "argon2id",
+			Argon2id:    &config.Argon2idConf{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+			Reset:       &config.ResetConf{TTL: 30 * time.Minute, URL: "http://localhost:3000/reset-password?token="},
+			Policy:      &config.PolicyConf{MinLength: 8},
+			HistorySize: 5,
+		},
+		Mail: &config.MailConf{Host: "127.0.0.1", Port: smtpPort, From: "no-reply@localhost"},
+		Throttle: &config.ThrottleConf{
+			Window: 15 * time.Minute,
+			Login:  &config.ThrottleRuleConf{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute},
+			IP:     &config.ThrottleRuleConf{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: time.Minute},
+			Email:  &config.SendLimitConf{Window: time.Hour, PerAddress: 3, PerIP: 5},
+		},
+		MFA:       &config.MFAConf{Issuer: "Users", Skew: 1, ChallengeTTL: 5 * time.Minute, MaxAttempts: 5, RecoveryCodes: 10, TrustedDeviceTTL: 720 * time.Hour},
+		WebAuthn:  &config.WebAuthnConf{RPID: "localhost", RPDisplayName: "Users", Origins: []string{testOrigin}, Timeout: 5 * time.Minute},
+		MagicLink: &config.MagicLinkConf{TTL: 15 * time.Minute, URL: "http://localhost:3000/magic-link?token=", MaxAttempts: 5},
+	}
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	logger := zap.NewNop().Sugar()
+	smtpServer := newSMTPServer(t)
+	cfg := testConfig(smtpServer.port)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	passwords, err := password.New(cfg.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := keys.New(cfg.Token, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webAuthn, err := passkey.New(cfg.WebAuthn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breached, err := password.OpenBreachList(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := mailer.New(cfg.Mail, logger)
+	t.Cleanup(mail.Close)
+
+	hash, pepperVersion, err := passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUsers{users: map[string]*fakeUser{
+		testPublicID: {
+			Credentials: models.Credentials{
+				PublicID:      testPublicID,
+				Login:         testLogin,
+				PasswordHash:  hash,
+				PepperVersion: pepperVersion,
+				Roles:         []string{models.RoleCandidate},
+			},
+			email: testEmail,
+		},
+	}}
+	passkeys := &fakePasskeys{passkeys: map[string][]*models.Passkey{}}
+	repos := &repository.Repository{
+		AuthRepository:       users,
+		TokenRepository:      repository.NewTokenRepository(client),
+		RevocationRepository: repository.NewRevocationRepository(client, cfg.Token.Revocation.CacheTTL),
+		ResetRepository:      repository.NewResetRepository(client),
+		ThrottleRepository:   repository.NewThrottleRepository(client, cfg.Throttle),
+		MFARepository:        users,
+		ChallengeRepository:  repository.NewChallengeRepository(client),
+		PasskeyRepository:    passkeys,
+		CeremonyRepository:   repository.NewCeremonyRepository(client),
+		MagicLinkRepository:  repository.NewMagicLinkRepository(client),
+		DeviceRepository:     repository.NewDeviceRepository(client),
+		RecruiterRepository:  fakeRole{},
+		CandidateRepository:  fakeRole{},
+	}
+	svc := NewAuthService(repos, token.NewManager(ring, cfg.Token), passwords, breached, mail, webAuthn, cfg, logger)
+	return &testEnv{service: svc.(*authService), redis: mr, users: users, passkeys: passkeys, smtp: smtpServer}
+}
+
+// signIn - signs the test user in with the password
+func (e *testEnv) signIn(t *testing.T) *models.Tokens {
+	t.Helper()
+	result, err := e.service.CandidateLogin(&models.UserSignInRequest{Login: testLogin, Password: testPassword}, testClient)
+	if err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+	return result.Tokens
+}
+
+// isRevokedElsewhere - checks the token against the revocation list as another instance of the service that has not
+// cached the revocation, so that time fast forwarded in redis counts
+func (e *testEnv) isRevokedElsewhere(t *testing.T, token *models.Token) bool {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: e.redis.Addr()})
+	t.Cleanup(func() { client.Close() })
+	revoked, err := repository.NewRevocationRepository(client, time.Second).IsRevoked(token.ID, token.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revoked
+}
+
+type fakeUser struct {
+	models.Credentials
+	email        string
+	history      []*models.PasswordHistoryEntry
+	totp         *models.TOTP
+	recoveryCode map[string]bool
+}
+
+// fakeUsers - the users table with their passwords and second factors, see repository.AuthRepository and
+// repository.MFARepository
+type fakeUsers struct {
+	users map[string]*fakeUser
+}
+
+// add - adds a user with the login and email and without a password
+func (f *fakeUsers) add(login, email string) {
+	publicID := "user-" + login
+	f.users[publicID] = &fakeUser{Credentials: models.Credentials{PublicID: publicID, Login: login}, email: email}
+}
+
+func (f *fakeUsers) byLogin(login string) *fakeUser {
+	for _, user := range f.users {
+		if user.Login == login {
+			return user
+		}
+	}
+	return nil
+}
+
+func (f *fakeUsers) GetUserInfoByLogin(login string) (*models.Credentials, error) {
+	user := f.byLogin(login)
+	if user == nil {
+		return nil, models.ErrWrongCredential
+	}
+	creds := user.Credentials
+	return &creds, nil
+}
+
+func (f *fakeUsers) GetCredentials(publicID string) (*models.Credentials, error) {
+	user, ok := f.users[publicID]
+	if !ok {
+		return nil, models.ErrWrongCredential
+	}
+	creds := user.Credentials
+	return &creds, nil
+}
+
+func (f *fakeUsers) GetEmailByLogin(login string) (string, string, error) {
+	user := f.byLogin(login)
+	if user == nil {
+		return "", "", models.ErrWrongCredential
+	}
+	return user.PublicID, user.email, nil
+}
+
+func (f *fakeUsers) UpdatePassword(publicID, passwordHash string, pepperVersion int) error {
+	user := f.users[publicID]
+	user.PasswordHash, user.PepperVersion = passwordHash, pepperVersion
+	return nil
+}
+
+func (f *fakeUsers) ChangePassword(publicID, passwordHash string, pepperVersion int, historySize int) error {
+	user := f.users[publicID]
+	user.history = append([]*models.PasswordHistoryEntry{{PasswordHash: user.PasswordHash, PepperVersion: user.PepperVersion}}, user.history...)
+	if len(user.history) > historySize {
+		user.history = user.history[:historySize]
+	}
+	return f.UpdatePassword(publicID, passwordHash, pepperVersion)
+}
+
+func (f *fakeUsers) GetPasswordHistory(publicID string, limit int) ([]*models.PasswordHistoryEntry, error) {
+	history := f.users[publicID].history
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (f *fakeUsers) Exists(login string) (bool, error) {
+	return f.byLogin(login) != nil, nil
+}
+
+func (f *fakeUsers) CreateTOTP(publicID, secret string) error {
+	user := f.users[publicID]
+	if user.totp != nil && user.totp.Enabled {
+		return models.ErrMFAAlreadyEnabled
+	}
+	user.totp = &models.TOTP{Secret: secret}
+	return nil
+}
+
+func (f *fakeUsers) GetTOTP(publicID string) (*models.TOTP, error) {
+	user := f.users[publicID]
+	if user.totp == nil {
+		return nil, models.ErrMFANotEnrolled
+	}
+	totp := *user.totp
+	return &totp, nil
+}
+
+func (f *fakeUsers) EnableTOTP(publicID string, step int64, recoveryCodeHashes []string) error {
+	user := f.users[publicID]
+	user.totp.Enabled, user.totp.LastUsedStep = true, step
+	user.MFAEnabled = true
+	user.recoveryCode = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		user.recoveryCode[hash] = true
+	}
+	return nil
+}
+
+func (f *fakeUsers) UseTOTPStep(publicID string, step int64) (bool, error) {
+	user := f.users[publicID]
+	if user.totp.LastUsedStep >= step {
+		return false, nil
+	}
+	user.totp.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeUsers) UseRecoveryCode(publicID, codeHash string) (bool, error) {
+	user := f.users[publicID]
+	if !user.recoveryCode[codeHash] {
+		return false, nil
+	}
+	delete(user.recoveryCode, codeHash)
+	return true, nil
+}
+
+// fakePasskeys - the webauthn_credentials table. UsePasskey applies the sign counter rule of the SQL query, beforeUse
+// runs before it to let tests sign in concurrently
+type fakePasskeys struct {
+	passkeys  map[string][]*models.Passkey
+	beforeUse func()
+}
+
+func (f *fakePasskeys) CreatePasskey(publicID string, passkey *models.Passkey) error {
+	for _, passkeys := range f.passkeys {
+		for _, stored := range passkeys {
+			if bytes.Equal(stored.CredentialID, passkey.CredentialID) {
+				return models.ErrPasskeyExists
+			}
+		}
+	}
+	f.passkeys[publicID] = append(f.passkeys[publicID], passkey)
+	return nil
+}
+
+func (f *fakePasskeys) GetPasskeys(publicID string) ([]*models.Passkey, error) {
+	passkeys := make([]*models.Passkey, 0, len(f.passkeys[publicID]))
+	for _, stored := range f.passkeys[publicID] {
+		passkey := *stored
+		passkeys = append(passkeys, &passkey)
+	}
+	return passkeys, nil
+}
+
+func (f *fakePasskeys) UsePasskey(credentialID []byte, signCount uint32) (bool, error) {
+	if f.beforeUse != nil {
+		beforeUse := f.beforeUse
+		f.beforeUse = nil
+		beforeUse()
+	}
+	for _, passkeys := range f.passkeys {
+		for _, stored := range passkeys {
+			if !bytes.Equal(stored.CredentialID, credentialID) {
+				continue
+			}
+			if stored.SignCount < signCount || signCount == 0 {
+				stored.SignCount = signCount
+				return true, nil
+			}
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeRole - every user is a candidate and a recruiter
+type fakeRole struct{}
+
+func (fakeRole) CreateCandidate(*models.CandidateSignUpRequest) error { return nil }
+func (fakeRole) CreateRecruiter(*models.RecruiterSignUpRequest) error { return nil }
+func (fakeRole) Exists(string) (bool, error)                          { return true, nil }
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage - an email received by smtpServer, Data holds the headers and the body
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer - a minimal SMTP server that stands in for the mail server. It accepts every message, without
+// extensions or authentication, and hands it to the test through Messages
+type smtpServer struct {
+	listener net.Listener
+	port     int
+	messages chan *smtpMessage
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{
+		listener: listener,
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		messages: make(chan *smtpMessage, 16),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) bool {
+		return text.PrintfLine("%d %s", code, msg) == nil
+	}
+	if !reply(220, "localhost ESMTP test") {
+		return
+	}
+	msg := &smtpMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply(250, "localhost")
+		case "MAIL":
+			msg.From = smtpAddress(line)
+			reply(250, "OK")
+		case "RCPT":
+			msg.To = append(msg.To, smtpAddress(line))
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.messages <- msg
+			msg = &smtpMessage{}
+			reply(250, "OK")
+		case "RSET", "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// smtpAddress - returns the address of a MAIL FROM:<...> or RCPT TO:<...> command
+func smtpAddress(line string) string {
+	start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// Receive - waits for the next email
+func (s *smtpServer) Receive(t *testing.T) *smtpMessage {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was delivered")
+		return nil
+	}
+}
+
+// NoMessage - fails the test if an email is delivered shortly
+func (s *smtpServer) NoMessage(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		t.Fatalf("unexpected email to %v", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Link - returns the first line of the email that starts with prefix, e.g. the URL of an emailed link
+func (m *smtpMessage) Link(prefix string) string {
+	scanner := bufio.NewScanner(strings.NewReader(m.Data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
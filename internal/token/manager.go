@@ -0,0 +1,112 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Manager issues the tokens of this service and parses them back. Refresh tokens are only meant
+// for this service, so the issuer is their only audience, while access tokens are also issued for
+// the configured audiences.
+type Manager struct {
+	*Parser
+	ring *keys.Ring
+	cfg  *config.Token
+}
+
+func NewManager(ring *keys.Ring, cfg *config.Token) *Manager {
+	return &Manager{
+		Parser: NewParser(ring, &Policy{
+			Issuer:   cfg.Issuer,
+			Audience: cfg.Issuer,
+			Leeway:   cfg.Leeway,
+		}),
+		ring: ring,
+		cfg:  cfg,
+	}
+}
+
+// JWKS returns the public keys that tokens of this service can be verified with.
+func (m *Manager) JWKS() (*keys.JWKS, error) {
+	return m.ring.JWKS()
+}
+
+// AccessToken issues an access token for the session.
+func (m *Manager) AccessToken(session *models.Session) (*models.Token, error) {
+	return m.issue(session, models.AccessTokenType, uuid.NewString(), m.cfg.Access.TTL, m.accessAudience())
+}
+
+// ElevatedToken issues a short-lived access token for the session right after the user reauthenticated, so that
+// session.AuthTime is recent enough for sensitive operations.
+func (m *Manager) ElevatedToken(session *models.Session) (*models.Token, error) {
+	return m.issue(session, models.AccessTokenType, uuid.NewString(), m.cfg.StepUp.TTL, m.accessAudience())
+}
+
+// RefreshToken issues a refresh token for the session. tokenID is its jti, which identifies this exact refresh token.
+func (m *Manager) RefreshToken(session *models.Session, tokenID string) (*models.Token, error) {
+	return m.issue(session, models.RefreshTokenType, tokenID, m.cfg.Refresh.TTL, []string{m.cfg.Issuer})
+}
+
+func (m *Manager) issue(session *models.Session, tokenType, tokenID string, ttl time.Duration, audience []string) (*models.Token, error) {
+	key := m.ring.SigningKey()
+	if key == nil {
+		return nil, errors.New("no active signing key")
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	c := &claims{
+		PublicID:  session.PublicID,
+		Role:      session.Role,
+		TokenType: tokenType,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   session.PublicID,
+			Issuer:    m.cfg.Issuer,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	if !session.AuthTime.IsZero() {
+		c.AuthTime = jwt.NewNumericDate(session.AuthTime)
+		c.AMR = session.AMR
+		c.ACR = models.AuthContextClass(session.AMR)
+	}
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), c)
+	t.Header["kid"] = key.ID
+	tokenString, err := t.SignedString(key.Private)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Token{
+		ID:         tokenID,
+		TokenValue: tokenString,
+		PublicID:   session.PublicID,
+		SessionID:  session.ID,
+		Role:       session.Role,
+		TTL:        time.Until(exp),
+		IssuedAt:   now,
+		ExpiresAt:  exp,
+		AuthTime:   session.AuthTime,
+		AMR:        c.AMR,
+		ACR:        c.ACR,
+	}, nil
+}
+
+// accessAudience returns the configured audiences of access tokens, always including this service itself.
+func (m *Manager) accessAudience() []string {
+	for _, aud := range m.cfg.Audiences {
+		if aud == m.cfg.Issuer {
+			return m.cfg.Audiences
+		}
+	}
+	return append([]string{m.cfg.Issuer}, m.cfg.Audiences...)
+}
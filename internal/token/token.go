@@ -0,0 +1,105 @@
+// Package token is the only place where JWTs are issued and parsed. Tokens are signed with the
+// asymmetric keys of a keys.Ring and only the algorithms in keys.Algorithms are ever accepted.
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claims - the claims of access and refresh tokens. auth_time, amr and acr are those of OpenID Connect and are
+// carried by refresh tokens too, so that the tokens of a session keep describing the sign-in that started it
+type claims struct {
+	PublicID  string           `json:"user_public_id"`
+	Role      string           `json:"role"`
+	TokenType string           `json:"token_type"`
+	SessionID string           `json:"sid"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR       []string         `json:"amr,omitempty"`
+	ACR       string           `json:"acr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Policy - what the registered claims of a token are validated against.
+// Leeway is the clock skew tolerated between the issuer and the verifier. Empty Issuer and Audience are not checked
+type Policy struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Parser verifies tokens with the keys of a keys.Verifier and validates them against a Policy.
+type Parser struct {
+	verifier keys.Verifier
+	parser   *jwt.Parser
+}
+
+func NewParser(verifier keys.Verifier, policy *Policy) *Parser {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(policy.Leeway),
+	}
+	if policy.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(policy.Issuer))
+	}
+	if policy.Audience != "" {
+		opts = append(opts, jwt.WithAudience(policy.Audience))
+	}
+	return &Parser{
+		verifier: verifier,
+		parser:   jwt.NewParser(opts...),
+	}
+}
+
+// Parse verifies the token and checks that it is of tokenType, models.AccessTokenType or models.RefreshTokenType.
+func (p *Parser) Parse(tokenString string, tokenType string) (*models.Token, error) {
+	c := &claims{}
+	if _, err := p.parser.ParseWithClaims(tokenString, c, p.keyfunc); err != nil {
+		return nil, fmt.Errorf("could not parse token: %v %w", err, models.ErrInvalidToken)
+	}
+	if c.TokenType != tokenType {
+		return nil, fmt.Errorf("could not parse token: expected %s token, got %q: %w", tokenType, c.TokenType, models.ErrInvalidToken)
+	}
+	token := &models.Token{
+		ID:         c.ID,
+		PublicID:   c.PublicID,
+		SessionID:  c.SessionID,
+		TokenValue: tokenString,
+		Role:       c.Role,
+		TTL:        time.Until(c.ExpiresAt.Time),
+		ExpiresAt:  c.ExpiresAt.Time,
+		AMR:        c.AMR,
+		ACR:        c.ACR,
+	}
+	if c.IssuedAt != nil {
+		token.IssuedAt = c.IssuedAt.Time
+	}
+	if c.AuthTime != nil {
+		token.AuthTime = c.AuthTime.Time
+	}
+	return token, nil
+}
+
+// keyfunc selects the verification key by the kid header and rejects tokens whose
+// alg header does not match the algorithm the key was published with.
+func (p *Parser) keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, err := p.verifier.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
@@ -0,0 +1,162 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zhiyenbek/users-auth-service/config"
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
+	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	testIssuer = "users-auth-service"
+	testKeyID  = "test-key"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	cfg := &config.Token{
+		Issuer:    testIssuer,
+		Audiences: []string{"interviews-service"},
+		Leeway:    30 * time.Second,
+		Access:    &config.TokenConf{TTL: 15 * time.Minute},
+		Refresh:   &config.TokenConf{TTL: time.Hour},
+		StepUp:    &config.StepUpConf{TTL: 5 * time.Minute, MaxAge: 10 * time.Minute},
+		Signing: &config.SigningConf{
+			AllowEphemeral: true,
+			Keys:           []*config.SigningKeyConf{{ID: testKeyID, Algorithm: keys.AlgES256}},
+		},
+	}
+	ring, err := keys.New(cfg, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(ring, cfg)
+}
+
+// validClaims - the claims of an access token the manager would issue
+func validClaims() *claims {
+	now := time.Now()
+	return &claims{
+		PublicID:  "user",
+		Role:      models.RoleCandidate,
+		TokenType: models.AccessTokenType,
+		SessionID: "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token",
+			Subject:   "user",
+			Issuer:    testIssuer,
+			Audience:  []string{testIssuer},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+// sign - signs the claims with the method and the key, naming kid in the header
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, c *claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, c)
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString
+}
+
+func TestParse(t *testing.T) {
+	manager := newTestManager(t)
+	signingKey := manager.ring.SigningKey().Private
+	otherKey, err := keys.Generate("other-key", keys.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		valid bool
+	}{
+		{"valid", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodES256, signingKey, testKeyID, validClaims())
+		}, true},
+		{"alg none", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testKeyID, validClaims())
+		}, false},
+		{"HS256", func(t *testing.T) string {
+			// a classic confusion attack signs with the published public key as the HMAC secret
+			public, err := keys.NewJWK(manager.ring.SigningKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sign(t, jwt.SigningMethodHS256, []byte(public.X), testKeyID, validClaims())
+		}, false},
+		{"unknown kid", func(t *testing.T) string {
+			return sign(t, jwt.SigningMethodES256, otherKey.Private, otherKey.ID, validClaims())
+		}, false},
+		{"wrong iss", func(t *testing.T) string {
+			c := validClaims()
+			c.Issuer = "someone-else"
+			return sign(t, jwt.SigningMethodES256, signingKey, testKeyID, c)
+		}, false},
+		{"wrong aud", func(t *testing.T) string {
+			c := validClaims()
+			c.Audience = []string{"interviews-service"}
+			return sign(t, jwt.SigningMethodES256, signingKey, testKeyID, c)
+		}, false},
+		{"missing exp", func(t *testing.T) string {
+			c := validClaims()
+			c.ExpiresAt = nil
+			return sign(t, jwt.SigningMethodES256, signingKey, testKeyID, c)
+		}, false},
+		{"future nbf", func(t *testing.T) string {
+			c := validClaims()
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(manager.cfg.Leeway + time.Minute))
+			return sign(t, jwt.SigningMethodES256, signingKey, testKeyID, c)
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := manager.Parse(test.token(t), models.AccessTokenType)
+			if test.valid && err != nil {
+				t.Fatalf("valid token rejected: %v", err)
+			}
+			if !test.valid && !errors.Is(err, models.ErrInvalidToken) {
+				t.Fatalf("got %v, want %v", err, models.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestParseIssuedTokens(t *testing.T) {
+	manager := newTestManager(t)
+	session := &models.Session{ID: "session", PublicID: "user", Role: models.RoleCandidate}
+	access, err := manager.AccessToken(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := manager.RefreshToken(session, "refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := manager.Parse(access.TokenValue, models.AccessTokenType)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	if parsed.ID != access.ID || parsed.SessionID != session.ID || parsed.PublicID != session.PublicID {
+		t.Fatalf("parsed %+v, issued %+v", parsed, access)
+	}
+	if _, err := manager.Parse(refresh.TokenValue, models.RefreshTokenType); err != nil {
+		t.Fatalf("refresh token: %v", err)
+	}
+	if _, err := manager.Parse(refresh.TokenValue, models.AccessTokenType); !errors.Is(err, models.ErrInvalidToken) {
+		t.Fatalf("refresh token as access token: got %v, want %v", err, models.ErrInvalidToken)
+	}
+}
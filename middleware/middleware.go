@@ -1,32 +1,90 @@
 package middleware
 
 import (
+	"time"
+
 	handler "github.com/Zhiyenbek/users-auth-service/internal/handler/http"
+	"github.com/Zhiyenbek/users-auth-service/internal/keys"
 	"github.com/Zhiyenbek/users-auth-service/internal/models"
+	"github.com/Zhiyenbek/users-auth-service/internal/repository"
+	"github.com/Zhiyenbek/users-auth-service/internal/token"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v7"
 	"go.uber.org/zap"
 )
 
-func VerifyToken(tokenSecret string, log *zap.SugaredLogger) gin.HandlerFunc {
+// Config - how services that consume tokens of the auth service verify them
+type Config struct {
+	// JWKSURL is where the auth service publishes its public keys, e.g. http://users-auth-service/.well-known/jwks.json
+	JWKSURL string
+	// Redis is the redis of the auth service. When set, revoked access tokens are rejected
+	Redis *redis.Client
+	// RevocationCacheTTL is how long a token found not revoked is trusted without asking redis again
+	RevocationCacheTTL time.Duration
+	// Transport is where access tokens are read from: "cookie" (default), "bearer" or "both"
+	Transport string
+	// Issuer is the issuer of the auth service, Audience is the name of this service in the audiences of access tokens
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat
+	Leeway time.Duration
+}
+
+func VerifyToken(cfg Config, log *zap.SugaredLogger) gin.HandlerFunc {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		log.Warn("issuer or audience of access tokens is not configured and will not be checked")
+	}
+	parser := token.NewParser(keys.NewRemote(cfg.JWKSURL), &token.Policy{
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+		Leeway:   cfg.Leeway,
+	})
+	var revocations repository.RevocationRepository
+	if cfg.Redis != nil {
+		revocations = repository.NewRevocationRepository(cfg.Redis, cfg.RevocationCacheTTL)
+	}
 	return func(c *gin.Context) {
-		jwtToken, err := c.Cookie("access_token")
+		jwtToken, err := handler.ReadToken(c, "access_token", cfg.Transport)
 		if err != nil {
-			log.Error("cookie not found")
+			log.Error("access token not found")
 			c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 			return
 		}
-		token, err := handler.ParseAuthToken(jwtToken, tokenSecret)
+		token, err := parser.Parse(jwtToken, models.AccessTokenType)
 		if err != nil {
 			log.Error("token is invalid", err)
 			c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
 			return
 		}
+		if revocations != nil {
+			revoked, err := revocations.IsRevoked(token.ID, token.SessionID)
+			if err != nil {
+				log.Error("could not check token revocation", err)
+				c.AbortWithStatusJSON(500, sendResponse(-1, nil, models.ErrInternalServer))
+				return
+			}
+			if revoked {
+				log.Error("token is revoked")
+				c.AbortWithStatusJSON(401, sendResponse(-1, nil, models.ErrInvalidToken))
+				return
+			}
+		}
 		c.Set("role", token.Role)
 		c.Set("public_id", token.PublicID)
+		c.Set("session_id", token.SessionID)
+		handler.SetAuthContext(c, token)
 		// Pass on to the next-in-chain
 		c.Next()
 	}
 }
+
+// RequireRecentAuth - lets only requests through whose user signed in or reauthenticated within maxAge, e.g. to change
+// the email or delete the account. It has to run after VerifyToken, refused clients get an elevated token from the
+// POST /reauthenticate endpoint of the auth service and retry
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return handler.RequireRecentAuth(maxAge)
+}
+
 func sendResponse(status int, data interface{}, err error) gin.H {
 	var errResponse gin.H
 	if err != nil {